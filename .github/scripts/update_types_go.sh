@@ -26,6 +26,8 @@ echo "$header" > "$file_path"
 latest_input=$(docker run --rm -i amazon/aws-cli codebuild start-build --generate-cli-skeleton)
 converted=$(echo "$latest_input" | node .github/scripts/json-to-go.js)
 echo "$converted" >> "$file_path"
+# Embed options for codebuild-multirunner itself (defined in internal/types/options.go)
+sed -i 's/^type Build struct {$/&\n\tRunnerOptions `yaml:",inline"`/' "$file_path"
 gofumpt -w "$file_path"
 
 # Create PR if the file is updated
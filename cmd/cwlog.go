@@ -1,60 +1,111 @@
 package cmd
 
 import (
-	"fmt"
+	"errors"
 	"log"
+	"os"
+	"time"
 
 	"github.com/koh-sh/codebuild-multirunner/internal/cb"
 	"github.com/koh-sh/codebuild-multirunner/internal/cwlog"
+	"github.com/koh-sh/codebuild-multirunner/internal/s3log"
 	"github.com/spf13/cobra"
 )
 
+var (
+	follow     bool
+	logpollsec int
+)
+
 // logCmd represents the log command
 var logCmd = &cobra.Command{
 	Use:   "log",
 	Short: "Print CodeBuild log for a single build with a provided id.",
 	Long: `Print CodeBuild log for a single build with a provided id.
 
-Only CloudWatch Logs is supported.
-S3 Log is not supported`,
+CloudWatch Logs is used if it is enabled for the build, otherwise S3 Log is used.
+
+With --follow, new logs are printed until the build ends.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
 		cbclient, err := cb.NewCodeBuildAPI()
 		if err != nil {
 			log.Fatal(err)
 		}
-		group, stream, err := cwlog.GetCloudWatchLogSetting(cbclient, id)
-		if err != nil {
-			log.Fatal(err)
-		}
 		cwlclient, err := cwlog.NewCloudWatchLogsAPI()
 		if err != nil {
 			log.Fatal(err)
 		}
-		// first request will be invoked without token
-		token := ""
-		for {
-			res, err := cwlog.GetCloudWatchLogEvents(cwlclient, group, stream, token)
+		// print logs until the build ends if --follow option set
+		if follow {
+			status, err := cwlog.FollowCloudWatchLog(cbclient, cwlclient, id, os.Stdout, time.Duration(logpollsec)*time.Second)
+			if errors.Is(err, cwlog.ErrCloudWatchLogsDisabled) {
+				// S3 log is written when the build ends
+				status, err = waitAndPrintS3Log(cbclient, err)
+			}
 			if err != nil {
 				log.Fatal(err)
 			}
-			// NextForwardToken is..
-			// The token for the next set of items in the forward direction. The token expires
-			// after 24 hours. If you have reached the end of the stream, it returns the same
-			// token you passed in.
-			if *res.NextForwardToken == token {
-				break
+			// Exit with non-zero code if the build did not succeed
+			if status != "SUCCEEDED" {
+				log.Printf("%s [%s]\n", id, status)
+				os.Exit(2)
 			}
-			token = *res.NextForwardToken
-			for _, event := range res.Events {
-				fmt.Print(*event.Message)
+			return
+		}
+		group, stream, err := cwlog.GetCloudWatchLogSetting(cbclient, id)
+		if errors.Is(err, cwlog.ErrCloudWatchLogsDisabled) {
+			if err := printS3Log(cbclient, err); err != nil {
+				log.Fatal(err)
 			}
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		// first request will be invoked without token
+		if _, err := cwlog.PrintCloudWatchLogEvents(cwlclient, group, stream, "", os.Stdout); err != nil {
+			log.Fatal(err)
 		}
 	},
 }
 
+// print S3 log of the build. cwlerr is returned if S3 logs are disabled too
+func printS3Log(cbclient cb.CodeBuildAPI, cwlerr error) error {
+	bucket, key, err := s3log.GetS3LogLocation(cbclient, id)
+	if errors.Is(err, s3log.ErrS3LogsDisabled) {
+		return cwlerr
+	}
+	if err != nil {
+		return err
+	}
+	s3client, err := s3log.NewS3API()
+	if err != nil {
+		return err
+	}
+	return s3log.PrintS3Log(s3client, bucket, key, os.Stdout)
+}
+
+// wait for the build to end, print its S3 log and return the final status of the build
+func waitAndPrintS3Log(cbclient cb.CodeBuildAPI, cwlerr error) (string, error) {
+	if _, _, err := s3log.GetS3LogLocation(cbclient, id); err != nil {
+		if errors.Is(err, s3log.ErrS3LogsDisabled) {
+			return "", cwlerr
+		}
+		return "", err
+	}
+	// the build is left running on SIGINT or SIGTERM
+	task := &cb.Task{BuildID: id, Status: "IN_PROGRESS"}
+	if err := cb.FollowTasks(signalContext(), cbclient, []*cb.Task{task}, cb.RunOptions{PollSec: logpollsec}); err != nil {
+		exitOnWaitError(err)
+	}
+	return task.Status, printS3Log(cbclient, cwlerr)
+}
+
 func init() {
 	rootCmd.AddCommand(logCmd)
 	logCmd.Flags().StringVar(&id, "id", "", "CodeBuild build id for getting log")
 	logCmd.MarkFlagRequired("id")
+	logCmd.Flags().BoolVarP(&follow, "follow", "f", false, "keep printing new logs until the build ends, and exit with code 2 if the build did not succeed")
+	logCmd.Flags().IntVar(&logpollsec, "polling-span", 5, "polling span in second for new logs with --follow option")
 }
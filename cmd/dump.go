@@ -13,7 +13,7 @@ var dumpCmd = &cobra.Command{
 	Use:   "dump",
 	Short: "dump config for running CodeBuild projects",
 	Run: func(cmd *cobra.Command, args []string) {
-		conf, err := cb.DumpConfig(configfile)
+		conf, err := cb.DumpConfig(configfiles...)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/buildlog"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ids        []string
+	logsdir    string
+	failedonly bool
+)
+
+// logsCmd represents the logs command
+var logsCmd = &cobra.Command{
+	Use:   "logs",
+	Short: "manage logs of CodeBuild builds",
+}
+
+// logsSaveCmd represents the logs save command
+var logsSaveCmd = &cobra.Command{
+	Use:   "save",
+	Short: "save logs of CodeBuild builds with provided ids to a directory",
+	Long: `save logs of CodeBuild builds with provided ids to a directory.
+
+Each log is saved as <dir>/<project>-<build number>.log from CloudWatch Logs, or S3 if CloudWatch Logs is disabled.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := cb.NewCodeBuildAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		builds, err := cb.GetBuilds(client, ids)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(builds) < len(ids) {
+			log.Printf("%d of %d build(s) are not found.", len(ids)-len(builds), len(ids))
+		}
+		clients, err := buildlog.NewClients()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := buildlog.SaveBuilds(clients, logsdir, builds, failedonly); err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(logsCmd)
+	logsCmd.AddCommand(logsSaveCmd)
+	logsSaveCmd.Flags().StringSliceVar(&ids, "ids", []string{}, "CodeBuild build ids for saving logs")
+	logsSaveCmd.Flags().StringVar(&logsdir, "dir", ".", "directory to save logs to")
+	logsSaveCmd.Flags().BoolVar(&failedonly, "failed-only", false, "save only logs of builds which did not succeed")
+	logsSaveCmd.MarkFlagRequired("ids")
+}
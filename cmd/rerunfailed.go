@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/runstate"
+	"github.com/spf13/cobra"
+)
+
+// rerunFailedCmd represents the rerun-failed command
+var rerunFailedCmd = &cobra.Command{
+	Use:   "rerun-failed",
+	Short: "start builds again which did not succeed in a run",
+	Long: `start builds again which did not succeed in a run with the same config entries.
+
+Failed, skipped and not started builds of the run are started as a new run.
+dependsOn on builds which succeeded in the run is ignored.
+It exits with code 2 if any build did not succeed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		prev, err := runstate.Load(runstate.DefaultDir, runid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		prevTasks, err := prev.Tasks()
+		if err != nil {
+			log.Fatal(err)
+		}
+		rerun := runstate.RerunTasks(prevTasks)
+		if len(rerun) == 0 {
+			log.Printf("No failed builds in run %s.\n", prev.ID)
+			return
+		}
+		tasks, err := cb.NewTasks(runstate.Groups(rerun))
+		if err != nil {
+			log.Fatalf("Error resolving dependencies: %v\n", err)
+		}
+		client, err := cb.NewCodeBuildAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		// the new run refers to config files of the previous run
+		rec := newRunState(tasks, prev.ConfigFiles)
+		// in-progress builds are stopped on SIGINT or SIGTERM unless --no-stop-on-cancel option set
+		opts := cb.RunOptions{PollSec: pollsec, StopOnCancel: !nostoponcancel, OnUpdate: rec.Update}
+		if err := cb.FollowTasks(signalContext(), client, tasks, opts); err != nil {
+			exitOnWaitError(err)
+		}
+		cb.LogSummary(tasks, failureExcerpt())
+		if cb.HasFailedTask(tasks) {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(rerunFailedCmd)
+	rerunFailedCmd.Flags().StringVar(&runid, "run", "", "run id logged by the run command")
+	rerunFailedCmd.Flags().IntVar(&pollsec, "polling-span", 60, "polling span in second for builds status check")
+	rerunFailedCmd.Flags().BoolVar(&nostoponcancel, "no-stop-on-cancel", false, "specify if you don't want to stop in-progress builds on SIGINT or SIGTERM")
+	rerunFailedCmd.Flags().IntVar(&failureloglines, "failure-log-lines", 20, "number of the last log lines of failed builds shown in the summary (0 to disable)")
+	rerunFailedCmd.MarkFlagRequired("run")
+}
@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/report"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
 	"github.com/spf13/cobra"
 )
 
@@ -13,25 +15,49 @@ var retryCmd = &cobra.Command{
 	Use:   "retry",
 	Short: "retry CodeBuild build with a provided id",
 	Run: func(cmd *cobra.Command, args []string) {
+		// result is written to stdout as json or ndjson if --output option set
+		w, err := report.NewWriter(os.Stdout, output)
+		if err != nil {
+			log.Fatal(err)
+		}
 		client, err := cb.NewCodeBuildAPI()
 		if err != nil {
 			log.Fatal(err)
 		}
-		buildid, err := cb.RetryCodeBuild(client, id)
+		// failed builds of a batch build are retried with RetryBuildBatch if --batch option set
+		retry := cb.RetryCodeBuild
+		if batch {
+			retry = cb.RetryCodeBuildBatch
+		}
+		buildid, err := retry(client, id)
 		if err != nil {
 			log.Fatal(err)
 		}
+		tasks := []*cb.Task{{Build: types.Build{RunnerOptions: types.RunnerOptions{Batch: batch}}, BuildID: buildid, Status: "IN_PROGRESS"}}
 		// early return if --no-wait option set
 		if nowait {
+			if w != nil {
+				w.Update(tasks)
+			}
+			finishReport(w)
 			return
 		}
-		// check build status
-		failed := false
-		failed, err = cb.WaitAndCheckBuildStatus(client, []string{buildid}, pollsec)
+		// check build status. the build is stopped on SIGINT or SIGTERM unless --no-stop-on-cancel option set
+		ctx := signalContext()
+		opts := cb.RunOptions{PollSec: pollsec, StopOnCancel: !nostoponcancel}
+		if w != nil {
+			opts.OnUpdate = w.Update
+		}
+		err = cb.FollowTasks(ctx, client, tasks, opts)
+		finishReport(w)
 		if err != nil {
-			log.Fatal(err)
+			exitOnWaitError(err)
+		}
+		// statuses of builds in the batch build
+		for _, c := range tasks[0].BatchChildren() {
+			log.Printf("%s [%s] %s\n", c.Identifier, cb.ColoredString(c.Status), c.BuildID)
 		}
-		if failed {
+		if cb.HasFailedTask(tasks) {
 			os.Exit(2)
 		}
 	},
@@ -41,6 +67,9 @@ func init() {
 	rootCmd.AddCommand(retryCmd)
 	retryCmd.Flags().BoolVar(&nowait, "no-wait", false, "specify if you don't need to follow builds status")
 	retryCmd.Flags().IntVar(&pollsec, "polling-span", 60, "polling span in second for builds status check")
+	retryCmd.Flags().BoolVar(&nostoponcancel, "no-stop-on-cancel", false, "specify if you don't want to stop the build on SIGINT or SIGTERM")
+	retryCmd.Flags().StringVarP(&output, "output", "o", report.FormatText, "output format of the build result to stdout (text, json or ndjson)")
 	retryCmd.Flags().StringVar(&id, "id", "", "CodeBuild build id for retry")
+	retryCmd.Flags().BoolVar(&batch, "batch", false, "retry failed builds of a batch build with the id")
 	retryCmd.MarkFlagRequired("id")
 }
@@ -1,19 +1,28 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/koh-sh/codebuild-multirunner/internal/report"
 	"github.com/spf13/cobra"
 )
 
 // options
 
 var (
-	id         string
-	nowait     bool
-	pollsec    int
-	configfile string
+	id             string
+	nowait         bool
+	pollsec        int
+	configfiles    []string
+	nostoponcancel bool
+	output         string
+	batch          bool
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -34,10 +43,36 @@ func Execute() {
 }
 
 func init() {
-	rootCmd.PersistentFlags().StringVar(&configfile, "config", "./.codebuild-multirunner.yaml", "file path for config file.")
+	rootCmd.PersistentFlags().StringArrayVar(&configfiles, "config", []string{"./.codebuild-multirunner.yaml"}, "file path for config file. can be specified multiple times to layer files in order.")
 }
 
 // set version from goreleaser variables
 func SetVersionInfo(version, commit, date string) {
 	rootCmd.Version = fmt.Sprintf("%s (Built on %s from Git SHA %s)", version, date, commit)
 }
+
+// return context canceled on SIGINT or SIGTERM.
+// signal handling is reset after the first signal so that the second one terminates the process immediately
+func signalContext() context.Context {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	context.AfterFunc(ctx, stop)
+	return ctx
+}
+
+// exit if err is caused by canceling, otherwise log err and exit
+func exitOnWaitError(err error) {
+	if errors.Is(err, context.Canceled) {
+		os.Exit(130)
+	}
+	log.Fatal(err)
+}
+
+// write results of builds for --output option. w is nil for the text output
+func finishReport(w *report.Writer) {
+	if w == nil {
+		return
+	}
+	if err := w.Finish(); err != nil {
+		log.Printf("failed to write output: %v\n", err)
+	}
+}
@@ -1,24 +1,51 @@
 package cmd
 
 import (
-	"fmt"
+	"context"
 	"log"
 	"os"
 	"sync"
 
+	"github.com/koh-sh/codebuild-multirunner/internal/buildlog"
 	"github.com/koh-sh/codebuild-multirunner/internal/cb"
-	"github.com/koh-sh/codebuild-multirunner/internal/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cwlog"
+	"github.com/koh-sh/codebuild-multirunner/internal/dashboard"
+	"github.com/koh-sh/codebuild-multirunner/internal/report"
+	"github.com/koh-sh/codebuild-multirunner/internal/runstate"
+	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
 )
 
-var targets []string
+var (
+	targets           []string
+	sequentialTargets bool
+	failfast          bool
+	maxparallel       int
+	retryfailed       int
+	retrybackoff      int
+	junitreport       string
+	followlogs        bool
+	savelogs          string
+	savefailedonly    bool
+	failureloglines   int
+	nodashboard       bool
+)
 
 // runCmd represents the run command
 var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "run CodeBuild projects based on YAML",
 	Run: func(cmd *cobra.Command, args []string) {
-		parsedBuilds, isMapFormat, err := cb.ReadConfigFile(configfile)
+		// results are written to stdout as json or ndjson if --output option set
+		w, err := report.NewWriter(os.Stdout, output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if w != nil && followlogs {
+			log.Fatalf("--follow-logs option can not be used with --output %s\n", output)
+		}
+
+		config, err := cb.ReadConfigFile(configfiles...)
 		if err != nil {
 			log.Fatalf("Error reading config file: %v\n", err)
 		}
@@ -29,80 +56,256 @@ var runCmd = &cobra.Command{
 		}
 
 		// Determine builds to run using the new function in internal/cb
-		buildsToRun, err := cb.FilterBuildsByTarget(parsedBuilds, isMapFormat, targets)
+		groupsToRun, err := cb.FilterBuildsByTarget(config.Builds, config.IsMapFormat, targets)
 		if err != nil {
 			log.Fatalf("Error filtering builds: %v\n", err)
 		}
 
-		// Run specified codebuild projects in parallel
-		var wg sync.WaitGroup
-		idsChan := make(chan string, len(buildsToRun))
-		errChan := make(chan error, len(buildsToRun))
+		// Builds without dependsOn are started at once, others wait for their upstreams
+		tasks, err := cb.NewTasks(groupsToRun)
+		if err != nil {
+			log.Fatalf("Error resolving dependencies: %v\n", err)
+		}
+
+		// Run all groups at once, or one group after another if --sequential-targets option set
+		stages := [][]*cb.Task{tasks}
+		if sequentialTargets {
+			if nowait {
+				log.Fatal("--no-wait option can not be used with --sequential-targets")
+			}
+			stages, err = cb.SplitTasksIntoStages(tasks)
+			if err != nil {
+				log.Fatalf("Error resolving dependencies: %v\n", err)
+			}
+		}
 
-		for _, build := range buildsToRun {
-			wg.Add(1)
-			go func(b types.Build) {
-				defer wg.Done()
-				input, err := cb.ConvertBuildConfigToStartBuildInput(b)
-				if err != nil {
-					errChan <- fmt.Errorf("failed to convert build config for %s: %w", b.ProjectName, err)
-					return
+		// Limit number of in-progress builds by --max-parallel option and maxParallel of groups
+		opts := cb.RunOptions{
+			PollSec:          pollsec,
+			StopOnCancel:     !nostoponcancel,
+			FailFast:         failfast,
+			MaxParallel:      maxparallel,
+			GroupMaxParallel: map[string]int{},
+			Retries:          retryfailed,
+			RetryBackoffSec:  retrybackoff,
+		}
+		for name, group := range config.Groups {
+			opts.GroupMaxParallel[name] = group.MaxParallel
+		}
+		// Options following builds can not be used with --no-wait option.
+		// they are checked before the run is recorded not to leave a run whose builds are never started
+		if nowait {
+			if failfast {
+				log.Fatal("--no-wait option can not be used with --fail-fast")
+			}
+			if maxparallel > 0 {
+				log.Fatal("--no-wait option can not be used with --max-parallel")
+			}
+			for _, g := range groupsToRun {
+				if limit := opts.GroupMaxParallel[g.Name]; limit > 0 && len(g.Builds) > limit {
+					log.Fatalf("--no-wait option can not be used with maxParallel of group '%s'\n", g.Name)
 				}
-				id, err := cb.RunCodeBuild(client, input)
-				if err != nil {
-					errChan <- fmt.Errorf("failed to start build for %s: %w", b.ProjectName, err)
-				} else {
-					idsChan <- id
+			}
+			if retryfailed > 0 {
+				log.Fatal("--no-wait option can not be used with --retry-failed")
+			}
+			if junitreport != "" {
+				log.Fatal("--no-wait option can not be used with --junit-report")
+			}
+			if followlogs {
+				log.Fatal("--no-wait option can not be used with --follow-logs")
+			}
+			if savelogs != "" {
+				log.Fatal("--no-wait option can not be used with --save-logs")
+			}
+			for _, t := range tasks {
+				if len(t.Build.DependsOn) > 0 {
+					log.Fatalf("--no-wait option can not be used with dependsOn (build '%s')\n", t.Name())
 				}
-			}(build)
+				if t.Build.Retries > 0 {
+					log.Fatalf("--no-wait option can not be used with retries (build '%s')\n", t.Name())
+				}
+			}
 		}
-
-		wg.Wait()
-		close(idsChan)
-		close(errChan)
-
-		// Collect results
-		ids := []string{}
-		runErrors := []error{}
-		for id := range idsChan {
-			ids = append(ids, id)
+		// Logs of running builds are printed to stdout if --follow-logs option set
+		var follower *cwlog.LogFollower
+		if followlogs {
+			cwlclient, err := cwlog.NewCloudWatchLogsAPI()
+			if err != nil {
+				log.Fatal(err)
+			}
+			follower = cwlog.NewLogFollower(cwlclient, os.Stdout)
 		}
-		for err := range errChan {
-			log.Println(err) // Log each run error immediately
-			runErrors = append(runErrors, err)
+		// Record builds of the run for rerun-failed, wait and stop commands
+		rec := newRunState(tasks, configfiles)
+		// hooks called on each status update of builds
+		hooks := []func(tasks []*cb.Task){rec.Update}
+		if w != nil {
+			w.Update(tasks)
+			hooks = append(hooks, w.Update)
 		}
-
-		// Exit if there were errors starting builds
-		if len(runErrors) > 0 {
-			log.Printf("%d build(s) failed to start.", len(runErrors))
-			os.Exit(1)
+		opts.OnUpdate = func(tasks []*cb.Task) {
+			for _, hook := range hooks {
+				hook(tasks)
+			}
 		}
 
-		// Early return if --no-wait option set or no builds were successfully started
-		if nowait || len(ids) == 0 {
-			if len(ids) == 0 {
-				log.Println("No builds were started successfully.")
+		// Only start builds if --no-wait option set as dependsOn requires following builds status
+		if nowait {
+			cb.StartReadyTasks(client, tasks, opts)
+			rec.Update(tasks)
+		} else {
+			stopLogs := func() {}
+			if follower != nil {
+				hooks = append(hooks, follower.Update)
+				stopLogs = follower.Start(cwlog.FollowInterval)
 			}
-			return
+			// in-progress builds are stopped on SIGINT or SIGTERM unless --no-stop-on-cancel option set
+			ctx := signalContext()
+			// Render a dashboard in place of log lines if stdout is a terminal
+			stopDashboard := func() {}
+			if w == nil && !followlogs && !nodashboard && isatty.IsTerminal(os.Stdout.Fd()) {
+				d := dashboard.New(os.Stdout)
+				d.Update(tasks)
+				hooks = append(hooks, d.Update)
+				stop := d.Start(dashboard.RefreshInterval)
+				// logs such as errors starting builds are shown after the dashboard
+				log.SetOutput(d.LogWriter(os.Stderr))
+				stopOnce := sync.OnceFunc(func() {
+					stop()
+					log.SetOutput(os.Stderr)
+				})
+				// logs of canceling are shown after the dashboard
+				context.AfterFunc(ctx, stopOnce)
+				stopDashboard = func() {
+					// skipped groups are not updated by following tasks
+					d.Update(tasks)
+					stopOnce()
+				}
+			}
+			for i, stage := range stages {
+				if err := cb.FollowTasks(ctx, client, stage, opts); err != nil {
+					rec.Update(tasks)
+					stopDashboard()
+					stopLogs()
+					finishReport(w)
+					writeJUnitReport(tasks)
+					saveLogs(tasks)
+					exitOnWaitError(err)
+				}
+				// Stop at the first failing stage
+				if cb.HasFailedTask(stage) && i < len(stages)-1 {
+					log.Printf("group '%s' failed. Remaining groups are not run.", stage[0].Group)
+					for _, rest := range stages[i+1:] {
+						for _, t := range rest {
+							t.Status = cb.StatusSkipped
+						}
+					}
+					break
+				}
+			}
+			// save statuses of skipped groups which are not updated by following tasks
+			rec.Update(tasks)
+			stopDashboard()
+			stopLogs()
+			cb.LogSummary(tasks, failureExcerpt())
+			writeJUnitReport(tasks)
+			saveLogs(tasks)
 		}
+		finishReport(w)
 
-		// Check build status
-		failed := false
-		failed, err = cb.WaitAndCheckBuildStatus(client, ids, pollsec)
-		if err != nil {
-			log.Fatal(err)
+		// Exit if there were errors starting builds
+		started, startErrors := 0, 0
+		for _, t := range tasks {
+			if t.BuildID != "" {
+				started++
+			}
+			if t.Status == cb.StatusFailedToStart {
+				startErrors++
+			}
+		}
+		if startErrors > 0 {
+			log.Printf("%d build(s) failed to start.", startErrors)
+			os.Exit(1)
+		}
+		if started == 0 {
+			log.Println("No builds were started successfully.")
+			return
 		}
 
-		// Exit with non-zero code if any build failed (either starting or during run)
-		if failed { // WaitAndCheckBuildStatus indicates a failure during run
+		// Exit with non-zero code if any build failed or was skipped
+		if !nowait && cb.HasFailedTask(tasks) {
 			os.Exit(2)
 		}
 	},
 }
 
+// return a new record of tasks run with config files saved to the state file. the run id is logged to refer to the run later
+func newRunState(tasks []*cb.Task, files []string) *runstate.Run {
+	rec, err := runstate.New(runstate.DefaultDir, files)
+	if err != nil {
+		log.Fatal(err)
+	}
+	rec.Update(tasks)
+	log.Printf("Run ID: %s (state file: %s)\n", rec.ID, rec.Path())
+	return rec
+}
+
+// write JUnit XML report if --junit-report option set
+func writeJUnitReport(tasks []*cb.Task) {
+	if junitreport == "" {
+		return
+	}
+	if err := report.WriteJUnit(junitreport, tasks); err != nil {
+		log.Printf("failed to write JUnit report: %v\n", err)
+	}
+}
+
+// return function to get the last lines of logs of failed builds for the summary
+func failureExcerpt() func(t *cb.Task) []string {
+	if failureloglines <= 0 {
+		return nil
+	}
+	cwlclient, err := cwlog.NewCloudWatchLogsAPI()
+	if err != nil {
+		log.Printf("failed to get logs of failed builds: %v\n", err)
+		return nil
+	}
+	return func(t *cb.Task) []string {
+		return cwlog.FailureExcerpt(cwlclient, t, failureloglines)
+	}
+}
+
+// save logs of builds if --save-logs option set
+func saveLogs(tasks []*cb.Task) {
+	if savelogs == "" {
+		return
+	}
+	clients, err := buildlog.NewClients()
+	if err == nil {
+		err = buildlog.SaveTasks(clients, savelogs, tasks, savefailedonly)
+	}
+	if err != nil {
+		log.Printf("failed to save logs: %v\n", err)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().BoolVar(&nowait, "no-wait", false, "specify if you don't need to follow builds status")
 	runCmd.Flags().IntVar(&pollsec, "polling-span", 60, "polling span in second for builds status check")
+	runCmd.Flags().BoolVar(&nostoponcancel, "no-stop-on-cancel", false, "specify if you don't want to stop in-progress builds on SIGINT or SIGTERM")
 	runCmd.Flags().StringSliceVar(&targets, "targets", []string{}, "Specify target group(s) to run (only available for map format config)")
+	runCmd.Flags().BoolVar(&failfast, "fail-fast", false, "stop all other in-progress builds and exit as soon as any build failed")
+	runCmd.Flags().IntVar(&maxparallel, "max-parallel", 0, "maximum number of builds running at once. builds past the limit are queued (0 means unlimited)")
+	runCmd.Flags().IntVar(&retryfailed, "retry-failed", 0, "number of retries of FAILED, FAULT or TIMED_OUT builds (overridden by retries of each build)")
+	runCmd.Flags().IntVar(&retrybackoff, "retry-backoff", 0, "wait in second before the first retry, doubled for each following retry")
+	runCmd.Flags().StringVarP(&output, "output", "o", report.FormatText, "output format of build results to stdout (text, json or ndjson)")
+	runCmd.Flags().StringVar(&junitreport, "junit-report", "", "file path to write JUnit XML report of builds")
+	runCmd.Flags().BoolVar(&followlogs, "follow-logs", false, "print CloudWatch logs of running builds to stdout with a [group/project] prefix")
+	runCmd.Flags().StringVar(&savelogs, "save-logs", "", "directory to save logs of builds to as <group>/<project>-<build number>.log after builds end")
+	runCmd.Flags().BoolVar(&savefailedonly, "save-logs-failed-only", false, "save only logs of failed builds with --save-logs option")
+	runCmd.Flags().IntVar(&failureloglines, "failure-log-lines", 20, "number of the last log lines of failed builds shown in the summary (0 to disable)")
+	runCmd.Flags().BoolVar(&nodashboard, "no-dashboard", false, "print log lines instead of the dashboard even if stdout is a terminal")
+	runCmd.Flags().BoolVar(&sequentialTargets, "sequential-targets", false, "run target groups one after another in the order of --targets (alphabetical order if not specified) and stop at the first failing group")
 }
@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/report"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+)
+
+var wait bool
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show status of CodeBuild builds with provided ids",
+	Long: `show status of CodeBuild builds with provided ids.
+
+Build ids are read from stdin separated by spaces, commas or newlines if --ids is not specified.
+With --wait, it waits for the builds to end and exits with code 2 if any build did not succeed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if output != report.FormatText && output != report.FormatJSON {
+			log.Fatalf("unsupported output format '%s'. use one of %s, %s\n", output, report.FormatText, report.FormatJSON)
+		}
+		if len(ids) == 0 && !isatty.IsTerminal(os.Stdin.Fd()) {
+			ids = readIDs(os.Stdin)
+		}
+		if len(ids) == 0 {
+			log.Fatal("no build ids are provided")
+		}
+		client, err := cb.NewCodeBuildAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		failed := false
+		if wait {
+			// builds are left running on SIGINT or SIGTERM
+			failed, err = cb.WaitAndCheckBuildStatus(signalContext(), client, ids, cb.RunOptions{PollSec: pollsec})
+			if err != nil {
+				exitOnWaitError(err)
+			}
+		}
+		builds, err := cb.GetBuilds(client, ids)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := report.WriteStatus(os.Stdout, output, report.NewStatusRecords(ids, builds)); err != nil {
+			log.Fatal(err)
+		}
+		if failed {
+			os.Exit(2)
+		}
+	},
+}
+
+// read build ids separated by spaces, commas or newlines
+func readIDs(r io.Reader) []string {
+	ids := []string{}
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		for _, id := range strings.Split(scanner.Text(), ",") {
+			if id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+	return ids
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	statusCmd.Flags().StringSliceVar(&ids, "ids", []string{}, "CodeBuild build ids to show status")
+	statusCmd.Flags().BoolVar(&wait, "wait", false, "wait for the builds to end")
+	statusCmd.Flags().IntVar(&pollsec, "polling-span", 60, "polling span in second for builds status check with --wait option")
+	statusCmd.Flags().StringVarP(&output, "output", "o", report.FormatText, "output format of build status to stdout (text or json)")
+}
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/runstate"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+	"github.com/spf13/cobra"
+)
+
+var stoppollsec int
+
+// stopCmd represents the stop command
+var stopCmd = &cobra.Command{
+	Use:   "stop",
+	Short: "stop CodeBuild builds",
+	Long: `stop in-progress CodeBuild builds.
+
+With --id, the build with the id is stopped.
+With --run, in-progress builds of a run are stopped and their statuses are saved to the state file of the run.
+With --targets, the latest in-progress build of each project in the target groups is stopped.
+It waits for the builds to be STOPPED unless --no-wait is specified, and exits with code 1 if any build failed to stop.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client, err := cb.NewCodeBuildAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		var rec *runstate.Run
+		var recTasks []*cb.Task
+		tasks := []*cb.Task{}
+		switch {
+		case id != "":
+			tasks = append(tasks, newStopTask(id, batch))
+		case runid != "":
+			rec, err = runstate.Load(runstate.DefaultDir, runid)
+			if err != nil {
+				log.Fatal(err)
+			}
+			recTasks, err = rec.Tasks()
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, t := range recTasks {
+				if t.BuildID != "" && !t.Ended() {
+					tasks = append(tasks, newStopTask(t.BuildID, t.Build.Batch))
+				}
+			}
+		default:
+			tasks = latestBuildsOfTargets(client)
+		}
+		if len(tasks) == 0 {
+			log.Println("No in-progress builds to stop.")
+			return
+		}
+
+		failures := stopBuilds(client, tasks)
+		if rec != nil {
+			statuses := make(map[string]string, len(tasks))
+			for _, t := range tasks {
+				statuses[t.BuildID] = t.Status
+			}
+			for _, t := range recTasks {
+				if s, ok := statuses[t.BuildID]; ok {
+					t.Status = s
+				}
+			}
+			rec.Update(recTasks)
+		}
+		if failures > 0 {
+			log.Printf("%d build(s) failed to stop.\n", failures)
+			os.Exit(1)
+		}
+	},
+}
+
+// return task to stop a build or a batch build. it is followed without retries and dependencies
+func newStopTask(buildid string, batch bool) *cb.Task {
+	return &cb.Task{Build: types.Build{RunnerOptions: types.RunnerOptions{Batch: batch}}, BuildID: buildid}
+}
+
+// return tasks of the latest in-progress build of each project in groups of --targets.
+// batch builds are looked up for entries with batch
+func latestBuildsOfTargets(client cb.CodeBuildAPI) []*cb.Task {
+	config, err := cb.ReadConfigFile(configfiles...)
+	if err != nil {
+		log.Fatalf("Error reading config file: %v\n", err)
+	}
+	groups, err := cb.FilterBuildsByTarget(config.Builds, config.IsMapFormat, targets)
+	if err != nil {
+		log.Fatalf("Error filtering builds: %v\n", err)
+	}
+	tasks := []*cb.Task{}
+	type project struct {
+		name  string
+		batch bool
+	}
+	seen := make(map[project]bool)
+	for _, g := range groups {
+		for _, b := range g.Builds {
+			key := project{b.ProjectName, b.Batch}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			latest := cb.LatestInProgressBuild
+			if b.Batch {
+				latest = cb.LatestInProgressBuildBatch
+			}
+			buildid, err := latest(client, b.ProjectName)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if buildid == "" {
+				log.Printf("%s has no in-progress builds\n", b.ProjectName)
+				continue
+			}
+			tasks = append(tasks, newStopTask(buildid, b.Batch))
+		}
+	}
+	return tasks
+}
+
+// stop in-progress builds of tasks and wait for them to end unless --no-wait option set.
+// statuses of tasks are updated and number of builds which failed to stop is returned
+func stopBuilds(client cb.CodeBuildAPI, tasks []*cb.Task) int {
+	statuses, err := currentStatuses(client, tasks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	stopping := []*cb.Task{}
+	failures := 0
+	for _, t := range tasks {
+		status, ok := statuses[t.BuildID]
+		switch {
+		case !ok:
+			t.Status = cb.StatusNotFound
+			log.Printf("%s [%s]\n", t.BuildID, cb.ColoredString(t.Status))
+			failures++
+		case status != string(cbtypes.StatusTypeInProgress):
+			t.Status = status
+			log.Printf("%s [%s] is not in progress\n", t.BuildID, cb.ColoredString(status))
+		default:
+			t.Status = status
+			stop := cb.StopCodeBuild
+			if t.Build.Batch {
+				stop = cb.StopCodeBuildBatch
+			}
+			if err := stop(client, t.BuildID); err != nil {
+				log.Printf("failed to stop build %s: %v\n", t.BuildID, err)
+				failures++
+				continue
+			}
+			stopping = append(stopping, t)
+		}
+	}
+	if nowait || len(stopping) == 0 {
+		return failures
+	}
+
+	// builds are stopped already so there is nothing to cancel
+	if err := cb.FollowTasks(context.Background(), client, stopping, cb.RunOptions{PollSec: stoppollsec}); err != nil {
+		log.Fatal(err)
+	}
+	stopped := 0
+	for _, t := range stopping {
+		if t.Status == string(cbtypes.StatusTypeStopped) {
+			stopped++
+		}
+	}
+	log.Printf("%d of %d build(s) stopped.\n", stopped, len(stopping))
+	return failures
+}
+
+// return current statuses of builds and batch builds of tasks by build id
+func currentStatuses(client cb.CodeBuildAPI, tasks []*cb.Task) (map[string]string, error) {
+	ids, batchIDs := []string{}, []string{}
+	for _, t := range tasks {
+		if t.Build.Batch {
+			batchIDs = append(batchIDs, t.BuildID)
+		} else {
+			ids = append(ids, t.BuildID)
+		}
+	}
+	statuses := make(map[string]string, len(tasks))
+	if len(ids) > 0 {
+		builds, err := cb.GetBuilds(client, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range builds {
+			statuses[*b.Id] = string(b.BuildStatus)
+		}
+	}
+	if len(batchIDs) > 0 {
+		batches, err := cb.GetBuildBatches(client, batchIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range batches {
+			statuses[*b.Id] = string(b.BuildBatchStatus)
+		}
+	}
+	return statuses, nil
+}
+
+func init() {
+	rootCmd.AddCommand(stopCmd)
+	stopCmd.Flags().StringVar(&id, "id", "", "CodeBuild build id to stop")
+	stopCmd.Flags().BoolVar(&batch, "batch", false, "stop a batch build with the id")
+	stopCmd.Flags().StringVar(&runid, "run", "", "run id logged by the run command to stop its in-progress builds")
+	stopCmd.Flags().StringSliceVar(&targets, "targets", []string{}, "target group(s) to stop the latest in-progress build of each project")
+	stopCmd.Flags().BoolVar(&nowait, "no-wait", false, "specify if you don't need to wait for the builds to be STOPPED")
+	stopCmd.Flags().IntVar(&stoppollsec, "polling-span", 5, "polling span in second for builds status check")
+	stopCmd.MarkFlagsOneRequired("id", "run", "targets")
+	stopCmd.MarkFlagsMutuallyExclusive("id", "run", "targets")
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"log"
+	"os"
+
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/runstate"
+	"github.com/spf13/cobra"
+)
+
+var runid string
+
+// waitCmd represents the wait command
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "wait for builds of a run to end",
+	Long: `wait for in-progress builds of a run started with "run --no-wait" to end.
+
+Statuses of the builds are saved to the state file of the run.
+It exits with code 2 if any build of the run did not succeed.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		rec, err := runstate.Load(runstate.DefaultDir, runid)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tasks, err := rec.Tasks()
+		if err != nil {
+			log.Fatal(err)
+		}
+		client, err := cb.NewCodeBuildAPI()
+		if err != nil {
+			log.Fatal(err)
+		}
+		running := []*cb.Task{}
+		for _, t := range tasks {
+			if t.Status == string(cbtypes.StatusTypeInProgress) {
+				running = append(running, t)
+			}
+		}
+		// builds are left running on SIGINT or SIGTERM as they were started by another command
+		opts := cb.RunOptions{PollSec: pollsec, OnUpdate: rec.Update}
+		if err := cb.FollowTasks(signalContext(), client, running, opts); err != nil {
+			exitOnWaitError(err)
+		}
+		cb.LogSummary(tasks, failureExcerpt())
+		if cb.HasFailedTask(tasks) {
+			os.Exit(2)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(waitCmd)
+	waitCmd.Flags().StringVar(&runid, "run", "", "run id logged by the run command")
+	waitCmd.Flags().IntVar(&pollsec, "polling-span", 60, "polling span in second for builds status check")
+	waitCmd.Flags().IntVar(&failureloglines, "failure-log-lines", 20, "number of the last log lines of failed builds shown in the summary (0 to disable)")
+	waitCmd.MarkFlagRequired("run")
+}
@@ -0,0 +1,115 @@
+package buildlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/cwlog"
+	"github.com/koh-sh/codebuild-multirunner/internal/s3log"
+)
+
+// Clients are api clients to read build logs
+type Clients struct {
+	CloudWatchLogs cwlog.CWLGetLogEventsAPI
+	S3             s3log.S3GetObjectAPI
+}
+
+// return Clients for CloudWatch Logs and S3
+func NewClients() (Clients, error) {
+	cwlclient, err := cwlog.NewCloudWatchLogsAPI()
+	if err != nil {
+		return Clients{}, err
+	}
+	s3client, err := s3log.NewS3API()
+	if err != nil {
+		return Clients{}, err
+	}
+	return Clients{CloudWatchLogs: cwlclient, S3: s3client}, nil
+}
+
+// write the whole log of a build to out from CloudWatch Logs, or S3 if CloudWatch Logs is disabled
+func Write(c Clients, build cbtypes.Build, out io.Writer) error {
+	id := aws.ToString(build.Id)
+	group, stream, err := cwlog.CloudWatchLogSetting(id, build)
+	if err == nil {
+		_, err = cwlog.PrintCloudWatchLogEvents(c.CloudWatchLogs, group, stream, "", out)
+		return err
+	}
+	if !errors.Is(err, cwlog.ErrCloudWatchLogsDisabled) {
+		return err
+	}
+	bucket, key, s3err := s3log.S3LogLocation(id, build)
+	if errors.Is(s3err, s3log.ErrS3LogsDisabled) {
+		return err
+	}
+	if s3err != nil {
+		return s3err
+	}
+	return s3log.PrintS3Log(c.S3, bucket, key, out)
+}
+
+// return path of the log file of a build. group is omitted if it is empty
+func Path(dir string, group string, build cbtypes.Build) string {
+	name := fmt.Sprintf("%s-%d.log", aws.ToString(build.ProjectName), aws.ToInt64(build.BuildNumber))
+	return filepath.Join(dir, group, name)
+}
+
+// save the log of a build to dir/group/project-buildnumber.log and return the path
+func Save(c Clients, dir string, group string, build cbtypes.Build) (string, error) {
+	path := Path(dir, group, build)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := Write(c, build, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", fmt.Errorf("failed to save log of %s: %w", aws.ToString(build.Id), err)
+	}
+	return path, f.Close()
+}
+
+// save logs of builds of tasks to dir. only logs of failed builds are saved if failedOnly is true
+func SaveTasks(c Clients, dir string, tasks []*cb.Task, failedOnly bool) error {
+	var errs []error
+	for _, t := range tasks {
+		// builds which were not started have no log
+		if t.Info == nil || (failedOnly && !t.Failed()) {
+			continue
+		}
+		path, err := Save(c, dir, t.Group, *t.Info)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("%s log saved to %s\n", t.BuildID, path)
+	}
+	return errors.Join(errs...)
+}
+
+// save logs of builds to dir. only logs of builds which did not succeed are saved if failedOnly is true
+func SaveBuilds(c Clients, dir string, builds []cbtypes.Build, failedOnly bool) error {
+	var errs []error
+	for _, b := range builds {
+		if failedOnly && (b.BuildStatus == cbtypes.StatusTypeSucceeded || b.BuildStatus == cbtypes.StatusTypeInProgress) {
+			continue
+		}
+		path, err := Save(c, dir, "", b)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		log.Printf("%s log saved to %s\n", aws.ToString(b.Id), path)
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,182 @@
+package buildlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+type MockCWLGetLogEventsAPI struct {
+	GetLogEventsMock func(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
+}
+
+func (m *MockCWLGetLogEventsAPI) GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+	return m.GetLogEventsMock(ctx, params, optFns...)
+}
+
+type MockS3GetObjectAPI struct {
+	GetObjectMock func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+func (m *MockS3GetObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.GetObjectMock(ctx, params, optFns...)
+}
+
+// return clients which return a log of the stream name or the key
+func newMockClients() Clients {
+	return Clients{
+		CloudWatchLogs: &MockCWLGetLogEventsAPI{
+			GetLogEventsMock: func(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+				if params.NextToken != nil {
+					return &cloudwatchlogs.GetLogEventsOutput{NextForwardToken: params.NextToken}, nil
+				}
+				events := []cwltypes.OutputLogEvent{{Message: aws.String("cloudwatch " + *params.LogStreamName + "\n")}}
+				return &cloudwatchlogs.GetLogEventsOutput{Events: events, NextForwardToken: aws.String("next")}, nil
+			},
+		},
+		S3: &MockS3GetObjectAPI{
+			GetObjectMock: func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+				var buf bytes.Buffer
+				gz := gzip.NewWriter(&buf)
+				gz.Write([]byte("s3 " + *params.Key + "\n"))
+				gz.Close()
+				return &s3.GetObjectOutput{Body: io.NopCloser(&buf)}, nil
+			},
+		},
+	}
+}
+
+// return a build with CloudWatch Logs or S3 logs
+func newBuild(project string, number int64, status cbtypes.StatusType, s3only bool) cbtypes.Build {
+	id := project + ":uuid"
+	logs := &cbtypes.LogsLocation{
+		CloudWatchLogs: &cbtypes.CloudWatchLogsConfig{Status: cbtypes.LogsConfigStatusTypeEnabled},
+		GroupName:      aws.String("/aws/codebuild/" + project),
+		StreamName:     aws.String("uuid"),
+	}
+	if s3only {
+		logs = &cbtypes.LogsLocation{
+			CloudWatchLogs: &cbtypes.CloudWatchLogsConfig{Status: cbtypes.LogsConfigStatusTypeDisabled},
+			S3Logs:         &cbtypes.S3LogsConfig{Status: cbtypes.LogsConfigStatusTypeEnabled},
+			S3LogsArn:      aws.String("arn:aws:s3:::bucket/logs/uuid.gz"),
+		}
+	}
+	return cbtypes.Build{Id: &id, ProjectName: &project, BuildNumber: &number, BuildStatus: status, Logs: logs}
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name    string
+		build   cbtypes.Build
+		want    string
+		wantErr bool
+	}{
+		{name: "CloudWatch Logs", build: newBuild("proj", 1, cbtypes.StatusTypeSucceeded, false), want: "cloudwatch uuid\n"},
+		{name: "S3 logs", build: newBuild("proj", 1, cbtypes.StatusTypeSucceeded, true), want: "s3 logs/uuid.gz\n"},
+		{
+			name: "no logs",
+			build: cbtypes.Build{Id: aws.String("proj:uuid"), Logs: &cbtypes.LogsLocation{
+				CloudWatchLogs: &cbtypes.CloudWatchLogsConfig{Status: cbtypes.LogsConfigStatusTypeDisabled},
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := Write(newMockClients(), tt.build, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Write() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if out.String() != tt.want {
+				t.Errorf("Write() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveTasks(t *testing.T) {
+	succeeded := newBuild("proj-a", 3, cbtypes.StatusTypeSucceeded, false)
+	failed := newBuild("proj-b", 7, cbtypes.StatusTypeFailed, true)
+	tasks := []*cb.Task{
+		{Group: "group1", BuildID: *succeeded.Id, Status: "SUCCEEDED", Info: &succeeded},
+		{Group: "group2", BuildID: *failed.Id, Status: "FAILED", Info: &failed},
+		// not started
+		{Group: "group2", Status: cb.StatusSkipped},
+	}
+	tests := []struct {
+		name       string
+		failedOnly bool
+		want       map[string]string
+	}{
+		{
+			name: "all builds",
+			want: map[string]string{
+				"group1/proj-a-3.log": "cloudwatch uuid\n",
+				"group2/proj-b-7.log": "s3 logs/uuid.gz\n",
+			},
+		},
+		{
+			name:       "failed builds only",
+			failedOnly: true,
+			want:       map[string]string{"group2/proj-b-7.log": "s3 logs/uuid.gz\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := SaveTasks(newMockClients(), dir, tasks, tt.failedOnly); err != nil {
+				t.Fatalf("SaveTasks() error = %v", err)
+			}
+			got := map[string]string{}
+			err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				b, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				rel, _ := filepath.Rel(dir, path)
+				got[filepath.ToSlash(rel)] = string(b)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SaveTasks() files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveBuilds(t *testing.T) {
+	dir := t.TempDir()
+	builds := []cbtypes.Build{
+		newBuild("proj-a", 1, cbtypes.StatusTypeSucceeded, false),
+		newBuild("proj-b", 2, cbtypes.StatusTypeTimedOut, false),
+	}
+	if err := SaveBuilds(newMockClients(), dir, builds, true); err != nil {
+		t.Fatalf("SaveBuilds() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "proj-a-1.log")); !os.IsNotExist(err) {
+		t.Errorf("SaveBuilds() saved log of succeeded build")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "proj-b-2.log")); err != nil {
+		t.Errorf("SaveBuilds() log of failed build not saved: %v", err)
+	}
+}
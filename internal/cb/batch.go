@@ -0,0 +1,152 @@
+package cb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/jinzhu/copier"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+// BatchChild is a build in a batch build
+type BatchChild struct {
+	Identifier string
+	BuildID    string
+	Status     string
+}
+
+// run CodeBuild Project as a batch build and return batch build id
+func RunCodeBuildBatch(client CodeBuildAPI, input codebuild.StartBuildBatchInput) (string, error) {
+	result, err := client.StartBuildBatch(context.Background(), &input)
+	if err != nil {
+		return "", err
+	}
+	id := *result.BuildBatch.Id
+	log.Printf("%s [STARTED]\n", id)
+	return id, nil
+}
+
+// retry failed builds of CodeBuild batch build
+func RetryCodeBuildBatch(client CodeBuildAPI, id string) (string, error) {
+	input := codebuild.RetryBuildBatchInput{Id: &id, RetryType: cbtypes.RetryBuildBatchTypeRetryFailedBuilds}
+	result, err := client.RetryBuildBatch(context.Background(), &input)
+	if err != nil {
+		return "", err
+	}
+	batchid := *result.BuildBatch.Id
+	log.Printf("%s [STARTED]\n", batchid)
+	return batchid, nil
+}
+
+// stop CodeBuild batch build
+func StopCodeBuildBatch(client CodeBuildAPI, id string) error {
+	input := codebuild.StopBuildBatchInput{Id: &id}
+	_, err := client.StopBuildBatch(context.Background(), &input)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s [STOPPING]\n", id)
+	return nil
+}
+
+// get batch builds with BatchGetBuildBatches. batch builds which are not found are not included
+func GetBuildBatches(client CodeBuildAPI, ids []string) ([]cbtypes.BuildBatch, error) {
+	input := codebuild.BatchGetBuildBatchesInput{Ids: ids}
+	result, err := client.BatchGetBuildBatches(context.Background(), &input)
+	if err != nil {
+		return nil, err
+	}
+	return result.BuildBatches, nil
+}
+
+// return id of the latest in-progress batch build of a project or empty string if there is none
+func LatestInProgressBuildBatch(client CodeBuildAPI, project string) (string, error) {
+	input := codebuild.ListBuildBatchesForProjectInput{
+		ProjectName: &project,
+		Filter:      &cbtypes.BuildBatchFilter{Status: cbtypes.StatusTypeInProgress},
+		SortOrder:   cbtypes.SortOrderTypeDescending,
+		MaxResults:  aws.Int32(1),
+	}
+	result, err := client.ListBuildBatchesForProject(context.Background(), &input)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Ids) == 0 {
+		return "", nil
+	}
+	return result.Ids[0], nil
+}
+
+// copy configuration read from yaml to codebuild.StartBuildBatchInput.
+// overrides named differently for batch builds are renamed and ones not available for batch builds are rejected
+func ConvertBuildConfigToStartBuildBatchInput(build types.Build) (codebuild.StartBuildBatchInput, error) {
+	input := codebuild.StartBuildBatchInput{}
+	unsupported := []string{}
+	if build.BuildStatusConfigOverride != (types.BuildStatusConfigOverride{}) {
+		unsupported = append(unsupported, "buildStatusConfigOverride")
+	}
+	if build.FleetOverride != (types.FleetOverride{}) {
+		unsupported = append(unsupported, "fleetOverride")
+	}
+	if build.AutoRetryLimitOverride != 0 {
+		unsupported = append(unsupported, "autoRetryLimitOverride")
+	}
+	if build.HostKernelOverride != "" {
+		unsupported = append(unsupported, "hostKernelOverride")
+	}
+	if len(unsupported) > 0 {
+		return input, fmt.Errorf("%s can not be used for batch builds", strings.Join(unsupported, ", "))
+	}
+	err := copier.CopyWithOption(&input, build, copier.Option{IgnoreEmpty: true, DeepCopy: true})
+	if err != nil {
+		return input, err
+	}
+	if build.TimeoutInMinutesOverride != 0 {
+		input.BuildTimeoutInMinutesOverride = aws.Int32(int32(build.TimeoutInMinutesOverride))
+	}
+	if build.ReportBuildStatusOverride {
+		input.ReportBuildBatchStatusOverride = aws.Bool(true)
+	}
+	return input, nil
+}
+
+// check batch builds status and return batch builds by batch build id.
+// status and current phase are logged in the same way as buildStatusCheck
+func buildBatchStatusCheck(client CodeBuildAPI, ids []string, last map[string]string) (map[string]cbtypes.BuildBatch, error) {
+	result, err := GetBuildBatches(client, ids)
+	if err != nil {
+		return nil, err
+	}
+	batches := make(map[string]cbtypes.BuildBatch, len(result))
+	for _, v := range result {
+		batches[*v.Id] = v
+		logStatusChange(*v.Id, string(v.BuildBatchStatus), v.CurrentPhase, v.StartTime, v.EndTime, last)
+	}
+	return batches, nil
+}
+
+// return builds of the current batch build of the task in the order of the batch.
+// builds which have not started yet are PENDING
+func (t *Task) BatchChildren() []BatchChild {
+	if t.BatchInfo == nil {
+		return nil
+	}
+	children := []BatchChild{}
+	for _, g := range t.BatchInfo.BuildGroups {
+		c := BatchChild{Identifier: aws.ToString(g.Identifier), Status: StatusPending}
+		if s := g.CurrentBuildSummary; s != nil {
+			c.Status = string(s.BuildStatus)
+			// build id is the resource of arn:aws:codebuild:<region>:<account>:build/<build id>
+			if _, id, ok := strings.Cut(aws.ToString(s.Arn), ":build/"); ok {
+				c.BuildID = id
+			}
+		}
+		children = append(children, c)
+	}
+	return children
+}
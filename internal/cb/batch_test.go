@@ -0,0 +1,136 @@
+package cb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	cmt "github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestConvertBuildConfigToStartBuildBatchInput(t *testing.T) {
+	tests := []struct {
+		name            string
+		build           cmt.Build
+		want            codebuild.StartBuildBatchInput
+		wantErrContains string
+	}{
+		{
+			name: "renamed overrides",
+			build: cmt.Build{
+				ProjectName:               "proj",
+				SourceVersion:             "main",
+				TimeoutInMinutesOverride:  30,
+				ReportBuildStatusOverride: true,
+				RunnerOptions:             cmt.RunnerOptions{Batch: true},
+			},
+			want: codebuild.StartBuildBatchInput{
+				ProjectName:                    aws.String("proj"),
+				SourceVersion:                  aws.String("main"),
+				BuildTimeoutInMinutesOverride:  aws.Int32(30),
+				ReportBuildBatchStatusOverride: aws.Bool(true),
+			},
+		},
+		{
+			name: "unsupported overrides",
+			build: cmt.Build{
+				ProjectName:            "proj",
+				FleetOverride:          cmt.FleetOverride{FleetArn: "arn"},
+				AutoRetryLimitOverride: 1,
+			},
+			wantErrContains: "fleetOverride, autoRetryLimitOverride can not be used for batch builds",
+		},
+		{
+			name:            "host kernel override",
+			build:           cmt.Build{ProjectName: "proj", HostKernelOverride: "kernel"},
+			wantErrContains: "hostKernelOverride can not be used for batch builds",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ConvertBuildConfigToStartBuildBatchInput(tt.build)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("ConvertBuildConfigToStartBuildBatchInput() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("ConvertBuildConfigToStartBuildBatchInput() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConvertBuildConfigToStartBuildBatchInput() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBatchChildren(t *testing.T) {
+	task := &Task{BatchInfo: &types.BuildBatch{BuildGroups: []types.BuildGroup{
+		{
+			Identifier: aws.String("build1"),
+			CurrentBuildSummary: &types.BuildSummary{
+				Arn:         aws.String("arn:aws:codebuild:ap-northeast-1:123456789012:build/proj:1234"),
+				BuildStatus: types.StatusTypeFailed,
+			},
+		},
+		{Identifier: aws.String("build2")},
+	}}}
+	want := []BatchChild{
+		{Identifier: "build1", BuildID: "proj:1234", Status: "FAILED"},
+		{Identifier: "build2", Status: StatusPending},
+	}
+	if got := task.BatchChildren(); !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchChildren() = %+v, want %+v", got, want)
+	}
+	if got := (&Task{}).BatchChildren(); got != nil {
+		t.Errorf("BatchChildren() = %+v, want nil", got)
+	}
+}
+
+func TestFollowTasksBatch(t *testing.T) {
+	mock := newMockTaskAPI(&[]string{})
+	// batch builds of project "<status>-xxx" end with the status. FAILED batch builds succeed on retry
+	mock.StartBuildBatchMock = func(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error) {
+		id := *params.ProjectName + ":batch"
+		return &codebuild.StartBuildBatchOutput{BuildBatch: &types.BuildBatch{Id: &id}}, nil
+	}
+	mock.BatchGetBuildBatchesMock = func(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error) {
+		batches := make([]types.BuildBatch, len(params.Ids))
+		for i, id := range params.Ids {
+			status, _, _ := strings.Cut(id, "-")
+			batches[i] = types.BuildBatch{Id: &id, BuildBatchStatus: types.StatusType(status)}
+		}
+		return &codebuild.BatchGetBuildBatchesOutput{BuildBatches: batches}, nil
+	}
+	mock.RetryBuildBatchMock = func(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error) {
+		if params.RetryType != types.RetryBuildBatchTypeRetryFailedBuilds {
+			t.Errorf("RetryBuildBatch() retry type = %v", params.RetryType)
+		}
+		id := strings.Replace(*params.Id, "FAILED", "SUCCEEDED", 1)
+		return &codebuild.RetryBuildBatchOutput{BuildBatch: &types.BuildBatch{Id: &id}}, nil
+	}
+
+	tasks, err := NewTasks([]BuildGroup{{Builds: []cmt.Build{
+		{ProjectName: "FAILED-batch", RunnerOptions: cmt.RunnerOptions{Batch: true, Retries: 1}},
+		{ProjectName: "SUCCEEDED-build"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FollowTasks(context.Background(), mock, tasks, RunOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tasks[0]; got.Status != "SUCCEEDED" || got.BatchInfo == nil || got.Info != nil ||
+		!reflect.DeepEqual(got.BuildIDs(), []string{"FAILED-batch:batch", "SUCCEEDED-batch:batch"}) {
+		t.Errorf("batch task = %+v", got)
+	}
+	if got := tasks[1]; got.Status != "SUCCEEDED" || got.Info == nil || got.BatchInfo != nil {
+		t.Errorf("build task = %+v", got)
+	}
+}
@@ -4,13 +4,18 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"maps"
 	"os"
+	"path/filepath"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
 	"github.com/fatih/color"
 	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/parser"
 	"github.com/jinzhu/copier"
 	"github.com/koh-sh/codebuild-multirunner/internal/types"
 )
@@ -20,6 +25,13 @@ type CodeBuildAPI interface {
 	BatchGetBuilds(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
 	StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
 	RetryBuild(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error)
+	StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error)
+	ListBuildsForProject(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error)
+	StartBuildBatch(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error)
+	BatchGetBuildBatches(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error)
+	RetryBuildBatch(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error)
+	StopBuildBatch(ctx context.Context, params *codebuild.StopBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildBatchOutput, error)
+	ListBuildBatchesForProject(ctx context.Context, params *codebuild.ListBuildBatchesForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildBatchesForProjectOutput, error)
 }
 
 // return CodeBuild api client
@@ -54,28 +66,194 @@ func RetryCodeBuild(client CodeBuildAPI, id string) (string, error) {
 	return buildid, err
 }
 
-// read yaml config file for builds definition
-// returns parsed builds (map or list) and a boolean indicating if it's the map format
-func ReadConfigFile(filepath string) (any, bool, error) {
-	var data map[string]any
-	b, err := os.ReadFile(filepath)
+// stop CodeBuild build
+func StopCodeBuild(client CodeBuildAPI, id string) error {
+	input := codebuild.StopBuildInput{Id: &id}
+	_, err := client.StopBuild(context.Background(), &input)
+	if err != nil {
+		return err
+	}
+	log.Printf("%s [STOPPING]\n", id)
+	return nil
+}
+
+// return id of the latest in-progress build of a project or empty string if there is none.
+// only the first page of builds is checked as in-progress builds are the most recent ones
+func LatestInProgressBuild(client CodeBuildAPI, project string) (string, error) {
+	input := codebuild.ListBuildsForProjectInput{ProjectName: &project, SortOrder: cbtypes.SortOrderTypeDescending}
+	result, err := client.ListBuildsForProject(context.Background(), &input)
 	if err != nil {
-		return nil, false, err
+		return "", err
 	}
-	expanded := os.ExpandEnv(string(b))
-	err = yaml.Unmarshal([]byte(expanded), &data)
+	if len(result.Ids) == 0 {
+		return "", nil
+	}
+	builds, err := GetBuilds(client, result.Ids)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to unmarshal yaml: %w", err)
+		return "", err
+	}
+	byID := make(map[string]cbtypes.Build, len(builds))
+	for _, b := range builds {
+		byID[*b.Id] = b
+	}
+	// ids are sorted from the latest one
+	for _, id := range result.Ids {
+		if b, ok := byID[id]; ok && b.BuildStatus == cbtypes.StatusTypeInProgress {
+			return id, nil
+		}
+	}
+	return "", nil
+}
+
+// stop builds, wait for them to end and return final statuses by build id
+func StopBuildsAndWait(client CodeBuildAPI, ids []string, pollsec int) (map[string]string, error) {
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		tasks = append(tasks, &Task{BuildID: id, Status: statusInProgress})
+	}
+	return stopTasksAndWait(client, tasks, pollsec)
+}
+
+// stop builds or batch builds of tasks, wait for them to end and return final statuses by build id.
+// tasks are not changed as copies of them without retries are followed
+func stopTasksAndWait(client CodeBuildAPI, tasks []*Task, pollsec int) (map[string]string, error) {
+	stopping := make([]*Task, 0, len(tasks))
+	for _, t := range tasks {
+		if err := t.stop(client); err != nil {
+			log.Printf("failed to stop build %s: %v\n", t.BuildID, err)
+		}
+		batch := types.Build{RunnerOptions: types.RunnerOptions{Batch: t.Build.Batch}}
+		stopping = append(stopping, &Task{Build: batch, BuildID: t.BuildID, Status: statusInProgress})
+	}
+	// builds are stopped already so there is nothing to cancel
+	if err := FollowTasks(context.Background(), client, stopping, RunOptions{PollSec: pollsec}); err != nil {
+		return nil, err
+	}
+	statuses := make(map[string]string, len(stopping))
+	for _, t := range stopping {
+		statuses[t.BuildID] = t.Status
+	}
+	return statuses, nil
+}
+
+// Config is a parsed config file
+type Config struct {
+	// map[string][]types.Build for the map format and []types.Build for the list format
+	Builds      any
+	IsMapFormat bool
+	// options of groups in the map format, keyed by group name
+	Groups map[string]types.GroupOptions
+}
+
+// read yaml config files for builds definition. later files override earlier ones,
+// groups of builds are merged by name and build entries of groups by id
+// returns parsed builds (map or list) with a boolean indicating if it's the map format, and options of groups
+func ReadConfigFile(filepaths ...string) (Config, error) {
+	if len(filepaths) == 0 {
+		return Config{}, fmt.Errorf("no config file specified")
+	}
+	var data map[string]any
+	// files included by any of config files are loaded only once
+	loaded := map[string]bool{}
+	for i, name := range filepaths {
+		if abs, err := filepath.Abs(name); err == nil && loaded[abs] {
+			continue
+		}
+		d, src, err := readConfigData(name)
+		if err != nil {
+			return Config{}, err
+		}
+		sources := configSources{root: src, fields: map[string]map[string]configSource{}}
+		if err := applyIncludes(d, src, sources, loaded); err != nil {
+			return Config{}, err
+		}
+		if i == 0 {
+			data = d
+			continue
+		}
+		if data, err = mergeConfigData(data, d); err != nil {
+			return Config{}, fmt.Errorf("failed to merge config file '%s': %w", name, err)
+		}
+	}
+	if err := applyTemplates(data); err != nil {
+		return Config{}, err
+	}
+	if err := applyDefaults(data); err != nil {
+		return Config{}, err
 	}
 
 	buildsData, ok := data["builds"]
 	if !ok {
-		return nil, false, fmt.Errorf("`builds` field not found in config file")
+		return Config{}, fmt.Errorf("`builds` field not found in config file")
+	}
+	builds, isMapFormat, err := parseBuilds(buildsData)
+	if err != nil {
+		return Config{}, err
+	}
+	config := Config{Builds: builds, IsMapFormat: isMapFormat}
+
+	if groupsData, ok := data["groups"]; ok {
+		if !isMapFormat {
+			return Config{}, fmt.Errorf("`groups` field is only available for the map format configuration file")
+		}
+		groupsYAML, err := yaml.Marshal(groupsData)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to re-marshal groups: %w", err)
+		}
+		if err := yaml.Unmarshal(groupsYAML, &config.Groups); err != nil {
+			return Config{}, fmt.Errorf("failed to unmarshal groups into target type: %w", err)
+		}
+		for name := range config.Groups {
+			if _, ok := builds.(map[string][]types.Build)[name]; !ok {
+				return Config{}, fmt.Errorf("group '%s' in `groups` field not found in `builds` field", name)
+			}
+		}
+	}
+	return config, nil
+}
+
+// read yaml config file into a map after expanding environment variables
+func readConfigData(name string) (map[string]any, configSource, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, configSource{}, err
+	}
+	expanded, err := expandVariables(name, string(b))
+	if err != nil {
+		return nil, configSource{}, err
+	}
+	data := map[string]any{}
+	if err := yaml.Unmarshal([]byte(expanded), &data); err != nil {
+		return nil, configSource{}, fmt.Errorf("failed to unmarshal yaml: %w", err)
 	}
+	if data == nil {
+		data = map[string]any{}
+	}
+	src := configSource{name: name}
+	// parse the file again to report positions of errors. it does not fail as Unmarshal succeeded
+	if file, err := parser.ParseBytes([]byte(expanded), 0); err == nil {
+		src.file = file
+	}
+	if err := locateTemplateRefs(data, src); err != nil {
+		return nil, configSource{}, err
+	}
+	return data, src, nil
+}
 
+// parse builds field and return parsed builds (map or list) and a boolean indicating if it's the map format
+func parseBuilds(buildsData any) (any, bool, error) {
 	switch buildsTyped := buildsData.(type) {
 	case map[string]any:
 		// New map format
+		for group, entries := range buildsTyped {
+			if list, ok := entries.([]any); ok {
+				expanded, err := expandMatrix(list)
+				if err != nil {
+					return nil, true, err
+				}
+				buildsTyped[group] = expanded
+			}
+		}
 		parsedMap := make(map[string][]types.Build)
 		buildsYAML, err := yaml.Marshal(buildsTyped) // Re-marshal to handle nested lists correctly
 		if err != nil {
@@ -85,10 +263,21 @@ func ReadConfigFile(filepath string) (any, bool, error) {
 		if err != nil {
 			return nil, true, fmt.Errorf("failed to unmarshal map builds into target type: %w", err)
 		}
+		builds := []types.Build{}
+		for _, group := range slices.Sorted(maps.Keys(parsedMap)) {
+			builds = append(builds, parsedMap[group]...)
+		}
+		if err := validateDependencies(builds); err != nil {
+			return nil, true, err
+		}
 		return parsedMap, true, nil
 	case []any:
 		// Legacy list format
 		fmt.Fprintf(os.Stderr, "\n⚠️  WARNING: List format for 'builds' is deprecated. Please migrate to map format.\n\n")
+		buildsTyped, err := expandMatrix(buildsTyped)
+		if err != nil {
+			return nil, false, err
+		}
 		parsedList := []types.Build{}
 		buildsYAML, err := yaml.Marshal(buildsTyped) // Re-marshal to handle list items correctly
 		if err != nil {
@@ -98,6 +287,9 @@ func ReadConfigFile(filepath string) (any, bool, error) {
 		if err != nil {
 			return nil, false, fmt.Errorf("failed to unmarshal list builds into target type: %w", err)
 		}
+		if err := validateDependencies(parsedList); err != nil {
+			return nil, false, err
+		}
 		return parsedList, false, nil
 	default:
 		return nil, false, fmt.Errorf("unexpected type for 'builds' field: %T", buildsData)
@@ -105,15 +297,25 @@ func ReadConfigFile(filepath string) (any, bool, error) {
 }
 
 // dump read config with environment variables inserted
-func DumpConfig(configfile string) (string, error) {
+func DumpConfig(configfiles ...string) (string, error) {
 	// Use ReadConfigFile to ensure deprecation warnings are shown
-	builds, _, err := ReadConfigFile(configfile)
+	config, err := ReadConfigFile(configfiles...)
 	if err != nil {
 		return "", err
 	}
 
 	// Reconstruct the config structure for dumping
-	configData := map[string]any{"builds": builds}
+	configData := map[string]any{"builds": config.Builds}
+	// groups only with defaults are merged into builds
+	groups := make(map[string]types.GroupOptions)
+	for name, g := range config.Groups {
+		if g != (types.GroupOptions{}) {
+			groups[name] = g
+		}
+	}
+	if len(groups) > 0 {
+		configData["groups"] = groups
+	}
 
 	// Marshal with options for pretty printing
 	d, err := yaml.MarshalWithOptions(&configData, yaml.Indent(4), yaml.IndentSequence(true))
@@ -134,90 +336,119 @@ func ConvertBuildConfigToStartBuildInput(build types.Build) (codebuild.StartBuil
 }
 
 // wait and check status of builds and return if any build failed
-func WaitAndCheckBuildStatus(client CodeBuildAPI, ids []string, pollsec int) (bool, error) {
-	var err error
-	failed := false
-	hasfailed := false
-	for {
-		// break if all builds end
-		if len(ids) == 0 {
-			return hasfailed, nil
-		}
-		time.Sleep(time.Duration(pollsec) * time.Second)
-		ids, failed, err = buildStatusCheck(client, ids)
-		if err != nil {
-			return false, err
-		}
-		if failed {
-			hasfailed = true
-		}
+func WaitAndCheckBuildStatus(ctx context.Context, client CodeBuildAPI, ids []string, opts RunOptions) (bool, error) {
+	tasks := make([]*Task, 0, len(ids))
+	for _, id := range ids {
+		tasks = append(tasks, &Task{BuildID: id, Status: statusInProgress})
 	}
+	if err := FollowTasks(ctx, client, tasks, opts); err != nil {
+		return false, err
+	}
+	return HasFailedTask(tasks), nil
 }
 
-// check builds status and return ongoing build ids
-func buildStatusCheck(client CodeBuildAPI, ids []string) ([]string, bool, error) {
-	inprogressids := []string{}
-	hasfailedbuild := false
+// get builds with BatchGetBuilds. builds which are not found are not included
+func GetBuilds(client CodeBuildAPI, ids []string) ([]cbtypes.Build, error) {
 	input := codebuild.BatchGetBuildsInput{Ids: ids}
 	result, err := client.BatchGetBuilds(context.Background(), &input)
 	if err != nil {
-		return nil, true, err
+		return nil, err
 	}
-	for _, v := range result.Builds {
-		log.Printf("%s [%s]\n", *v.Id, coloredString(string(v.BuildStatus)))
-		if v.BuildStatus == "IN_PROGRESS" {
-			inprogressids = append(inprogressids, *v.Id)
-		} else if v.BuildStatus != "SUCCEEDED" {
-			hasfailedbuild = true
-		}
+	return result.Builds, nil
+}
+
+// check builds status and return builds by build id.
+// status and current phase of each build are logged with elapsed time only if they changed from last,
+// which is updated with the logged ones
+func buildStatusCheck(client CodeBuildAPI, ids []string, last map[string]string) (map[string]cbtypes.Build, error) {
+	result, err := GetBuilds(client, ids)
+	if err != nil {
+		return nil, err
+	}
+	builds := make(map[string]cbtypes.Build, len(result))
+	for _, v := range result {
+		builds[*v.Id] = v
+		logStatusChange(*v.Id, string(v.BuildStatus), v.CurrentPhase, v.StartTime, v.EndTime, last)
 	}
-	return inprogressids, hasfailedbuild, nil
+	return builds, nil
+}
+
+// log status and current phase of a build with elapsed time only if they changed from last,
+// which is updated with the logged ones
+func logStatusChange(id string, status string, phase *string, start *time.Time, end *time.Time, last map[string]string) {
+	state := status
+	if status == statusInProgress && phase != nil {
+		state += " " + *phase
+	}
+	if last[id] == state {
+		return
+	}
+	last[id] = state
+	msg := fmt.Sprintf("%s [%s]", id, ColoredString(status))
+	if status == statusInProgress && phase != nil {
+		msg += " " + *phase
+	}
+	if elapsed := elapsedTime(start, end); elapsed != "" {
+		msg += " (" + elapsed + ")"
+	}
+	log.Println(msg)
+}
+
+// return elapsed time from start to end, or to now if end is nil. empty string is returned if start time is unknown
+func elapsedTime(start *time.Time, end *time.Time) string {
+	if start == nil {
+		return ""
+	}
+	e := time.Now()
+	if end != nil {
+		e = *end
+	}
+	return e.Sub(*start).Round(time.Second).String()
 }
 
 // return colored string for each CodeBuild statuses
-func coloredString(status string) string {
+func ColoredString(status string) string {
 	switch status {
 	case "SUCCEEDED":
 		return color.GreenString(status)
 	case "IN_PROGRESS":
 		return color.BlueString(status)
+	case StatusPending, StatusSkipped, StatusQueued, StatusRetrying:
+		return color.YellowString(status)
 	default:
 		return color.RedString(status)
 	}
 }
 
+// BuildGroup is a named group of builds in the map format config.
+// Name is empty for the list format config.
+type BuildGroup struct {
+	Name   string
+	Builds []types.Build
+}
+
 // FilterBuildsByTarget filters the builds based on the provided targets.
-// It returns a list of builds to run and an error if any target is invalid or not found.
-func FilterBuildsByTarget(parsedBuilds any, isMapFormat bool, targets []string) ([]types.Build, error) {
-	var buildsToRun []types.Build
+// It returns groups of builds to run in the order of targets, or in alphabetical order of group names
+// if no targets specified, and an error if any target is invalid or not found.
+func FilterBuildsByTarget(parsedBuilds any, isMapFormat bool, targets []string) ([]BuildGroup, error) {
+	var groupsToRun []BuildGroup
 
 	if isMapFormat {
 		groupedBuilds := parsedBuilds.(map[string][]types.Build)
 		if len(targets) == 0 {
 			// Run all builds from all groups if no targets specified
-			for _, groupBuilds := range groupedBuilds {
-				buildsToRun = append(buildsToRun, groupBuilds...)
+			// Sort group names as map iteration order is random
+			for _, name := range slices.Sorted(maps.Keys(groupedBuilds)) {
+				groupsToRun = append(groupsToRun, BuildGroup{Name: name, Builds: groupedBuilds[name]})
 			}
 		} else {
 			// Run builds only from specified target groups
-			foundTargets := make(map[string]bool)
 			for _, targetGroup := range targets {
-				if groupBuilds, ok := groupedBuilds[targetGroup]; ok {
-					buildsToRun = append(buildsToRun, groupBuilds...)
-					foundTargets[targetGroup] = true
-				} else {
+				groupBuilds, ok := groupedBuilds[targetGroup]
+				if !ok {
 					return nil, fmt.Errorf("targets group '%s' not found in config file", targetGroup)
 				}
-			}
-			// Check if any specified targets were not found
-			allTargetsFound := true
-			for _, t := range targets {
-				if !foundTargets[t] {
-					allTargetsFound = false
-				}
-			}
-			if !allTargetsFound {
-				return nil, fmt.Errorf("one or more specified targets groups were not found")
+				groupsToRun = append(groupsToRun, BuildGroup{Name: targetGroup, Builds: groupBuilds})
 			}
 		}
 	} else {
@@ -225,8 +456,8 @@ func FilterBuildsByTarget(parsedBuilds any, isMapFormat bool, targets []string)
 		if len(targets) > 0 {
 			return nil, fmt.Errorf("--targets option is only available for the map format configuration file")
 		}
-		buildsToRun = parsedBuilds.([]types.Build)
+		groupsToRun = []BuildGroup{{Builds: parsedBuilds.([]types.Build)}}
 	}
 
-	return buildsToRun, nil
+	return groupsToRun, nil
 }
@@ -1,13 +1,18 @@
 package cb
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
 	"github.com/fatih/color"
@@ -16,9 +21,16 @@ import (
 
 // mock api for StartBuild
 type MockCodeBuildAPI struct {
-	StartBuildMock     func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
-	BatchGetBuildsMock func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
-	RetryBuildMock     func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error)
+	StartBuildMock                 func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
+	BatchGetBuildsMock             func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
+	RetryBuildMock                 func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error)
+	StopBuildMock                  func(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error)
+	ListBuildsForProjectMock       func(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error)
+	StartBuildBatchMock            func(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error)
+	BatchGetBuildBatchesMock       func(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error)
+	RetryBuildBatchMock            func(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error)
+	StopBuildBatchMock             func(ctx context.Context, params *codebuild.StopBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildBatchOutput, error)
+	ListBuildBatchesForProjectMock func(ctx context.Context, params *codebuild.ListBuildBatchesForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildBatchesForProjectOutput, error)
 }
 
 func (m *MockCodeBuildAPI) StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
@@ -33,6 +45,34 @@ func (m *MockCodeBuildAPI) RetryBuild(ctx context.Context, params *codebuild.Ret
 	return m.RetryBuildMock(ctx, params, optFns...)
 }
 
+func (m *MockCodeBuildAPI) StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+	return m.StopBuildMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) ListBuildsForProject(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error) {
+	return m.ListBuildsForProjectMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) StartBuildBatch(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error) {
+	return m.StartBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) BatchGetBuildBatches(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error) {
+	return m.BatchGetBuildBatchesMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) RetryBuildBatch(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error) {
+	return m.RetryBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) StopBuildBatch(ctx context.Context, params *codebuild.StopBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildBatchOutput, error) {
+	return m.StopBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) ListBuildBatchesForProject(ctx context.Context, params *codebuild.ListBuildBatchesForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildBatchesForProjectOutput, error) {
+	return m.ListBuildBatchesForProjectMock(ctx, params, optFns...)
+}
+
 func NewMockCodeBuildAPI(startBuildMock func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error),
 	batchGetBuildsMock func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error),
 	retryBuildMock func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error),
@@ -78,63 +118,106 @@ func Test_buildStatusCheck(t *testing.T) {
 	tests := []struct {
 		name    string
 		ids     []string
-		want    []string
-		want2   bool
+		want    map[string]string
 		wantErr bool
 	}{
 		{
 			name:    "all builds ended",
 			ids:     []string{"project1:12345678", "project2:87654321"},
-			want:    []string{},
-			want2:   false,
+			want:    map[string]string{"project1:12345678": "SUCCEEDED", "project2:87654321": "SUCCEEDED"},
 			wantErr: false,
 		},
 		{
 			name:    "one builds in progress",
 			ids:     []string{"project1:12345678", "project2:in-progress"},
-			want:    []string{"project2:in-progress"},
-			want2:   false,
+			want:    map[string]string{"project1:12345678": "SUCCEEDED", "project2:in-progress": "IN_PROGRESS"},
 			wantErr: false,
 		},
 		{
 			name:    "one of builds failed",
 			ids:     []string{"project1:12345678", "project3:failed"},
-			want:    []string{},
-			want2:   true,
+			want:    map[string]string{"project1:12345678": "SUCCEEDED", "project3:failed": "FAILED"},
 			wantErr: false,
 		},
 		{
 			name:    "one of builds timeout",
 			ids:     []string{"project1:12345678", "project4:timeout"},
-			want:    []string{},
-			want2:   true,
+			want:    map[string]string{"project1:12345678": "SUCCEEDED", "project4:timeout": "TIMED_OUT"},
 			wantErr: false,
 		},
 		{
 			name:    "api error",
 			ids:     []string{"error:12345678"},
 			want:    nil,
-			want2:   true,
 			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got2, err := buildStatusCheck(mockCodeBuildAPI, tt.ids)
+			builds, err := buildStatusCheck(mockCodeBuildAPI, tt.ids, map[string]string{})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("buildStatusCheck() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			var got map[string]string
+			if builds != nil {
+				got = make(map[string]string, len(builds))
+				for id, b := range builds {
+					got[id] = string(b.BuildStatus)
+				}
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("buildStatusCheck() = %v, want %v", got, tt.want)
 			}
-			if !reflect.DeepEqual(got2, tt.want2) {
-				t.Errorf("buildStatusCheck() = %v, want %v", got2, tt.want2)
-			}
 		})
 	}
 }
 
+func Test_buildStatusCheckLogsChanges(t *testing.T) {
+	color.NoColor = true
+	start := time.Now().Add(-90 * time.Second)
+	end := start.Add(2 * time.Minute)
+	// build of each poll
+	polls := []types.Build{
+		{BuildStatus: types.StatusTypeInProgress, CurrentPhase: aws.String("QUEUED"), StartTime: &start},
+		{BuildStatus: types.StatusTypeInProgress, CurrentPhase: aws.String("QUEUED"), StartTime: &start},
+		{BuildStatus: types.StatusTypeInProgress, CurrentPhase: aws.String("BUILD"), StartTime: &start},
+		{BuildStatus: types.StatusTypeSucceeded, CurrentPhase: aws.String("COMPLETED"), StartTime: &start, EndTime: &end},
+	}
+	poll := 0
+	mockCodeBuildAPI := NewMockCodeBuildAPI(
+		nil,
+		func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+			b := polls[poll]
+			b.Id = aws.String("project:12345678")
+			poll++
+			return &codebuild.BatchGetBuildsOutput{Builds: []types.Build{b}}, nil
+		},
+		nil,
+	)
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(log.LstdFlags)
+	})
+	last := map[string]string{}
+	for range polls {
+		if _, err := buildStatusCheck(mockCodeBuildAPI, []string{"project:12345678"}, last); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"project:12345678 [IN_PROGRESS] QUEUED (1m30s)",
+		"project:12345678 [IN_PROGRESS] BUILD (1m30s)",
+		"project:12345678 [SUCCEEDED] (2m0s)",
+	}
+	if got := strings.Split(strings.TrimSpace(buf.String()), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("buildStatusCheck() logged %q, want %q", got, want)
+	}
+}
+
 func Test_RunCodeBuild(t *testing.T) {
 	mockCodeBuildAPI := NewMockCodeBuildAPI(
 		func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
@@ -236,6 +319,118 @@ func Test_RetryCodeBuild(t *testing.T) {
 	}
 }
 
+func Test_StopCodeBuild(t *testing.T) {
+	mockCodeBuildAPI := NewMockCodeBuildAPI(nil, nil, nil)
+	mockCodeBuildAPI.StopBuildMock = func(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+		if *params.Id == "error" {
+			return nil, errors.New("stop build error")
+		}
+		return &codebuild.StopBuildOutput{
+			Build: &types.Build{
+				Id:          params.Id,
+				BuildStatus: types.StatusTypeInProgress,
+			},
+		}, nil
+	}
+	tests := []struct {
+		name    string
+		id      string
+		wantErr bool
+	}{
+		{
+			name:    "basic",
+			id:      "project:12345678",
+			wantErr: false,
+		},
+		{
+			name:    "api error",
+			id:      "error",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := StopCodeBuild(mockCodeBuildAPI, tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("StopCodeBuild() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLatestInProgressBuild(t *testing.T) {
+	statuses := map[string]types.StatusType{
+		"proj:3": types.StatusTypeSucceeded,
+		"proj:2": types.StatusTypeInProgress,
+		"proj:1": types.StatusTypeInProgress,
+	}
+	mockCodeBuildAPI := NewMockCodeBuildAPI(nil,
+		func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+			builds := []types.Build{}
+			for _, id := range params.Ids {
+				builds = append(builds, types.Build{Id: aws.String(id), BuildStatus: statuses[id]})
+			}
+			return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+		}, nil)
+	mockCodeBuildAPI.ListBuildsForProjectMock = func(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error) {
+		switch *params.ProjectName {
+		case "error":
+			return nil, errors.New("list builds error")
+		case "proj":
+			return &codebuild.ListBuildsForProjectOutput{Ids: []string{"proj:3", "proj:2", "proj:1"}}, nil
+		}
+		return &codebuild.ListBuildsForProjectOutput{}, nil
+	}
+	tests := []struct {
+		name    string
+		project string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "latest in-progress build",
+			project: "proj",
+			want:    "proj:2",
+		},
+		{
+			name:    "no builds",
+			project: "empty",
+			want:    "",
+		},
+		{
+			name:    "api error",
+			project: "error",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LatestInProgressBuild(mockCodeBuildAPI, tt.project)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("LatestInProgressBuild() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("LatestInProgressBuild() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// return a build expanded from testdata/_test_matrix.yaml
+func matrixBuild(arch string, region string) cmt.Build {
+	return cmt.Build{
+		RunnerOptions: cmt.RunnerOptions{ID: "test-" + region + "-" + arch},
+		ProjectName:   "proj-test",
+		SourceVersion: "main",
+		EnvironmentVariablesOverride: []cmt.EnvironmentVariablesOverride{
+			{Name: "STAGE", Value: "test"},
+			{Name: "ARCH", Value: arch},
+			{Name: "REGION", Value: region},
+		},
+	}
+}
+
 func Test_ReadConfigFile(t *testing.T) {
 	type args struct {
 		filepath string
@@ -244,6 +439,7 @@ func Test_ReadConfigFile(t *testing.T) {
 		name            string
 		args            args
 		want            any
+		wantGroups      map[string]cmt.GroupOptions
 		wantErr         bool
 		wantErrContains string // Optional: check if error message contains this string
 	}{
@@ -279,6 +475,55 @@ func Test_ReadConfigFile(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "dependsOn",
+			args: args{"testdata/_test_depends_on.yaml"},
+			want: map[string][]cmt.Build{
+				"infra": {
+					{RunnerOptions: cmt.RunnerOptions{ID: "infra"}, ProjectName: "proj-infra"},
+				},
+				"app": {
+					{RunnerOptions: cmt.RunnerOptions{ID: "migrate", DependsOn: []string{"infra"}}, ProjectName: "proj-migrate"},
+					{RunnerOptions: cmt.RunnerOptions{ID: "app", DependsOn: []string{"infra", "migrate"}}, ProjectName: "proj-app"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:            "dependency cycle",
+			args:            args{"testdata/_test_depends_on_cycle.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "dependency cycle detected: a -> c -> b -> a",
+		},
+		{
+			name: "groups",
+			args: args{"testdata/_test_groups.yaml"},
+			want: map[string][]cmt.Build{
+				"group1": {
+					{ProjectName: "proj-a"},
+					{ProjectName: "proj-b"},
+				},
+			},
+			wantGroups: map[string]cmt.GroupOptions{
+				"group1": {MaxParallel: 1},
+			},
+			wantErr: false,
+		},
+		{
+			name:            "groups with list format",
+			args:            args{"testdata/_test_groups_list.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "`groups` field is only available for the map format",
+		},
+		{
+			name:            "unknown group in groups",
+			args:            args{"testdata/_test_groups_unknown.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "group 'group2' in `groups` field not found in `builds` field",
+		},
 		{
 			name:            "invalid yaml file",
 			args:            args{"testdata/_test3.yaml"},
@@ -292,6 +537,115 @@ func Test_ReadConfigFile(t *testing.T) {
 			want:    nil,
 			wantErr: true,
 		},
+		{
+			name: "matrix",
+			args: args{"testdata/_test_matrix.yaml"},
+			want: map[string][]cmt.Build{
+				"test": {
+					matrixBuild("amd64", "us-east-1"),
+					matrixBuild("amd64", "eu-west-1"),
+					matrixBuild("arm64", "us-east-1"),
+					{RunnerOptions: cmt.RunnerOptions{ID: "deploy", DependsOn: []string{"test-us-east-1-amd64"}}, ProjectName: "proj-deploy"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "defaults",
+			args: args{"testdata/_test_defaults.yaml"},
+			want: map[string][]cmt.Build{
+				"test": {
+					{
+						ProjectName:         "proj-test",
+						ComputeTypeOverride: "BUILD_GENERAL1_SMALL",
+						ImageOverride:       "aws/codebuild/standard:7.0",
+						EnvironmentVariablesOverride: []cmt.EnvironmentVariablesOverride{
+							{Name: "STAGE", Value: "dev"},
+							{Name: "LOG_LEVEL", Value: "info"},
+						},
+					},
+				},
+				"deploy": {
+					{
+						ProjectName:         "proj-deploy",
+						ComputeTypeOverride: "BUILD_GENERAL1_LARGE",
+						ImageOverride:       "aws/codebuild/standard:6.0",
+						EnvironmentVariablesOverride: []cmt.EnvironmentVariablesOverride{
+							{Name: "STAGE", Value: "prod"},
+							{Name: "LOG_LEVEL", Value: "debug"},
+							{Name: "TOKEN", Value: "/token", Type: "PARAMETER_STORE"},
+						},
+					},
+				},
+			},
+			wantGroups: map[string]cmt.GroupOptions{"deploy": {MaxParallel: 1}},
+			wantErr:    false,
+		},
+		{
+			name: "templates",
+			args: args{"testdata/_test_templates.yaml"},
+			want: map[string][]cmt.Build{
+				"deploy": {
+					{
+						ProjectName:         "proj-deploy",
+						SourceVersion:       "release",
+						ComputeTypeOverride: "BUILD_GENERAL1_LARGE",
+						ImageOverride:       "aws/codebuild/standard:7.0",
+						EnvironmentVariablesOverride: []cmt.EnvironmentVariablesOverride{
+							{Name: "STAGE", Value: "prod"},
+						},
+					},
+					{ProjectName: "proj-plain", ImageOverride: "aws/codebuild/standard:7.0"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name:            "unknown template",
+			args:            args{"testdata/_test_templates_unknown.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "testdata/_test_templates_unknown.yaml:8:9: unknown template 'missing'",
+		},
+		{
+			name:            "template cycle",
+			args:            args{"testdata/_test_templates_cycle.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "testdata/_test_templates_cycle.yaml:5:15: template cycle: a -> b -> a",
+		},
+		{
+			name: "include",
+			args: args{"testdata/_test_include.yaml"},
+			want: map[string][]cmt.Build{
+				"app":   {{ProjectName: "proj-app", SourceVersion: "main"}},
+				"team1": {{ProjectName: "proj-team1", SourceVersion: "main"}},
+				"team2": {{ProjectName: "proj-team2"}},
+			},
+			wantGroups: map[string]cmt.GroupOptions{"app": {MaxParallel: 1}, "team2": {MaxParallel: 2}},
+			wantErr:    false,
+		},
+		{
+			name:            "duplicate group of included file",
+			args:            args{"testdata/_test_include_duplicate.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "testdata/include/teams/team2.yaml:6:5: duplicate name 'team2' in `builds` field, already defined in testdata/_test_include_duplicate.yaml:5:5",
+		},
+		{
+			name:            "missing included file",
+			args:            args{"testdata/_test_include_missing.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "testdata/_test_include_missing.yaml:2:5: included file 'testdata/include/missing.yaml' not found",
+		},
+		{
+			name:            "unset environment variable",
+			args:            args{"testdata/_test_variables_missing.yaml"},
+			want:            nil,
+			wantErr:         true,
+			wantErrContains: "testdata/_test_variables_missing.yaml:\n  line 4: variable 'TEST_UNSET_BRANCH' is not set",
+		},
 		{
 			name:            "missing builds field",
 			args:            args{"testdata/_test_missing_builds.yaml"},
@@ -311,7 +665,7 @@ func Test_ReadConfigFile(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, _, err := ReadConfigFile(tt.args.filepath)
+			got, err := ReadConfigFile(tt.args.filepath)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("ReadConfigFile() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -319,8 +673,11 @@ func Test_ReadConfigFile(t *testing.T) {
 			if tt.wantErr && tt.wantErrContains != "" && !strings.Contains(err.Error(), tt.wantErrContains) {
 				t.Errorf("ReadConfigFile() error = %v, wantErr containing %q", err, tt.wantErrContains)
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("ReadConfigFile() got = %#v, want %#v", got, tt.want)
+			if !reflect.DeepEqual(got.Builds, tt.want) {
+				t.Errorf("ReadConfigFile() got = %#v, want %#v", got.Builds, tt.want)
+			}
+			if !reflect.DeepEqual(got.Groups, tt.wantGroups) {
+				t.Errorf("ReadConfigFile() got groups = %#v, want %#v", got.Groups, tt.wantGroups)
 			}
 		})
 	}
@@ -345,6 +702,11 @@ func Test_coloredString(t *testing.T) {
 			args: args{status: "IN_PROGRESS"},
 			want: color.BlueString("IN_PROGRESS"),
 		},
+		{
+			name: "SKIPPED",
+			args: args{status: "SKIPPED"},
+			want: color.YellowString("SKIPPED"),
+		},
 		{
 			name: "FAILED",
 			args: args{status: "FAILED"},
@@ -358,8 +720,8 @@ func Test_coloredString(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := coloredString(tt.args.status); got != tt.want {
-				t.Errorf("coloredString() = %v, want %v", got, tt.want)
+			if got := ColoredString(tt.args.status); got != tt.want {
+				t.Errorf("ColoredString() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -435,6 +797,15 @@ func Test_ConvertBuildConfigToStartBuildInput(t *testing.T) {
 			want:    codebuild.StartBuildInput{},
 			wantErr: false,
 		},
+		{
+			name: "runner options are not copied",
+			args: args{cmt.Build{
+				RunnerOptions: cmt.RunnerOptions{ID: "app", DependsOn: []string{"infra"}},
+				ProjectName:   "project",
+			}},
+			want:    codebuild.StartBuildInput{ProjectName: aws.String("project")},
+			wantErr: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -512,7 +883,7 @@ func TestWaitAndCheckBuildStatus(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := WaitAndCheckBuildStatus(mockCodeBuildAPI, tt.ids, tt.pollsec)
+			got, err := WaitAndCheckBuildStatus(context.Background(), mockCodeBuildAPI, tt.ids, RunOptions{PollSec: tt.pollsec})
 			if (err != nil) != tt.wantErr {
 				t.Errorf("WaitAndCheckBuildStatus() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -546,46 +917,41 @@ func TestFilterBuildsByTarget(t *testing.T) {
 		parsedBuilds any
 		isMapFormat  bool
 		targets      []string
-		want         []cmt.Build
+		want         []BuildGroup
 		wantErr      bool
-		// Flag to indicate order-independent comparison should be used
-		orderIndependent bool
 	}{
 		{
-			name:         "Map format, no targets",
+			name:         "Map format, no targets (alphabetical order)",
 			parsedBuilds: mapBuilds,
 			isMapFormat:  true,
 			targets:      []string{},
-			want: []cmt.Build{
-				{ProjectName: "proj-a"},
-				{ProjectName: "proj-b", SourceVersion: "develop"},
-				{ProjectName: "proj-c"},
+			want: []BuildGroup{
+				{Name: "emptyGroup", Builds: []cmt.Build{}},
+				{Name: "group1", Builds: []cmt.Build{{ProjectName: "proj-a"}}},
+				{Name: "group2", Builds: []cmt.Build{{ProjectName: "proj-b", SourceVersion: "develop"}, {ProjectName: "proj-c"}}},
 			},
-			wantErr:          false,
-			orderIndependent: true,
+			wantErr: false,
 		},
 		{
 			name:         "Map format, one target",
 			parsedBuilds: mapBuilds,
 			isMapFormat:  true,
 			targets:      []string{"group1"},
-			want: []cmt.Build{
-				{ProjectName: "proj-a"},
+			want: []BuildGroup{
+				{Name: "group1", Builds: []cmt.Build{{ProjectName: "proj-a"}}},
 			},
 			wantErr: false,
 		},
 		{
-			name:         "Map format, multiple targets",
+			name:         "Map format, multiple targets (order of targets)",
 			parsedBuilds: mapBuilds,
 			isMapFormat:  true,
-			targets:      []string{"group1", "group2"},
-			want: []cmt.Build{
-				{ProjectName: "proj-a"},
-				{ProjectName: "proj-b", SourceVersion: "develop"},
-				{ProjectName: "proj-c"},
+			targets:      []string{"group2", "group1"},
+			want: []BuildGroup{
+				{Name: "group2", Builds: []cmt.Build{{ProjectName: "proj-b", SourceVersion: "develop"}, {ProjectName: "proj-c"}}},
+				{Name: "group1", Builds: []cmt.Build{{ProjectName: "proj-a"}}},
 			},
-			wantErr:          false,
-			orderIndependent: true,
+			wantErr: false,
 		},
 		{
 			name:         "Map format, target not found",
@@ -600,7 +966,7 @@ func TestFilterBuildsByTarget(t *testing.T) {
 			parsedBuilds: mapBuilds,
 			isMapFormat:  true,
 			targets:      []string{"group1", "group3"},
-			want:         nil, // Expect error, so specific builds don't matter
+			want:         nil,
 			wantErr:      true,
 		},
 		{
@@ -608,7 +974,7 @@ func TestFilterBuildsByTarget(t *testing.T) {
 			parsedBuilds: mapBuilds,
 			isMapFormat:  true,
 			targets:      []string{"emptyGroup"},
-			want:         []cmt.Build{}, // Expect empty slice, no error
+			want:         []BuildGroup{{Name: "emptyGroup", Builds: []cmt.Build{}}},
 			wantErr:      false,
 		},
 		{
@@ -616,9 +982,8 @@ func TestFilterBuildsByTarget(t *testing.T) {
 			parsedBuilds: listBuilds,
 			isMapFormat:  false,
 			targets:      []string{},
-			want: []cmt.Build{
-				{ProjectName: "testproject", SourceVersion: "chore/test"},
-				{ProjectName: "testproject2"},
+			want: []BuildGroup{
+				{Builds: []cmt.Build{{ProjectName: "testproject", SourceVersion: "chore/test"}, {ProjectName: "testproject2"}}},
 			},
 			wantErr: false,
 		},
@@ -635,53 +1000,11 @@ func TestFilterBuildsByTarget(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := FilterBuildsByTarget(tt.parsedBuilds, tt.isMapFormat, tt.targets)
-
-			// Check error condition
 			if (err != nil) != tt.wantErr {
 				t.Errorf("FilterBuildsByTarget() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-
-			// If we expect an error, don't check the result further
-			if tt.wantErr {
-				return
-			}
-
-			// Both nil and empty slices represent "no builds" - consider them equal
-			if len(got) == 0 && len(tt.want) == 0 {
-				return
-			}
-
-			// For cases where order doesn't matter, use content-based comparison
-			if tt.orderIndependent {
-				// Check for same length first
-				if len(got) != len(tt.want) {
-					t.Errorf("FilterBuildsByTarget() got %d builds, want %d builds", len(got), len(tt.want))
-					return
-				}
-
-				// Create lookup map by ProjectName
-				wantBuilds := make(map[string]cmt.Build)
-				for _, build := range tt.want {
-					wantBuilds[build.ProjectName] = build
-				}
-
-				// Check each build in the result
-				for _, gotBuild := range got {
-					wantBuild, exists := wantBuilds[gotBuild.ProjectName]
-					if !exists {
-						t.Errorf("FilterBuildsByTarget() unexpected project %q in result", gotBuild.ProjectName)
-						continue
-					}
-
-					// Compare other fields
-					if gotBuild.SourceVersion != wantBuild.SourceVersion {
-						t.Errorf("FilterBuildsByTarget() project %q has SourceVersion = %q, want %q",
-							gotBuild.ProjectName, gotBuild.SourceVersion, wantBuild.SourceVersion)
-					}
-				}
-			} else if !reflect.DeepEqual(got, tt.want) {
-				// For cases where order matters, use exact DeepEqual
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("FilterBuildsByTarget() got = %v, want %v", got, tt.want)
 			}
 		})
@@ -0,0 +1,135 @@
+package cb
+
+import (
+	"fmt"
+	"slices"
+)
+
+// merge top-level defaults and defaults of groups into build entries of config data and remove them.
+// fields of entries win over defaults of groups which win over top-level defaults
+func applyDefaults(data map[string]any) error {
+	defaults, err := defaultsOf(data, "`defaults` field")
+	if err != nil {
+		return err
+	}
+	groupDefaults := make(map[string]map[string]any)
+	if groups, ok := data["groups"].(map[string]any); ok {
+		for name, g := range groups {
+			group, ok := g.(map[string]any)
+			if !ok {
+				continue
+			}
+			d, err := defaultsOf(group, fmt.Sprintf("defaults of group '%s'", name))
+			if err != nil {
+				return err
+			}
+			groupDefaults[name] = d
+		}
+	}
+
+	switch builds := data["builds"].(type) {
+	case map[string]any:
+		for name, entries := range builds {
+			base := mergeValues(defaults, groupDefaults[name]).(map[string]any)
+			builds[name] = mergeEntries(base, entries)
+		}
+	case []any:
+		data["builds"] = mergeEntries(defaults, builds)
+	}
+	return nil
+}
+
+// return defaults field of m as a map and remove it from m
+func defaultsOf(m map[string]any, name string) (map[string]any, error) {
+	v, ok := m["defaults"]
+	if !ok {
+		return map[string]any{}, nil
+	}
+	delete(m, "defaults")
+	d, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a map of build fields", name)
+	}
+	return d, nil
+}
+
+// return build entries merged into base. entries other than lists of maps are returned as they are
+func mergeEntries(base map[string]any, entries any) any {
+	list, ok := entries.([]any)
+	if !ok || len(base) == 0 {
+		return entries
+	}
+	merged := make([]any, len(list))
+	for i, e := range list {
+		if _, ok := e.(map[string]any); ok {
+			merged[i] = mergeValues(base, e)
+		} else {
+			merged[i] = e
+		}
+	}
+	return merged
+}
+
+// deep merge over into a copy of base. maps are merged by key,
+// environmentVariablesOverride lists are merged by name and other values of over replace ones of base
+func mergeValues(base any, over any) any {
+	bm, ok := base.(map[string]any)
+	om, ok2 := over.(map[string]any)
+	if !ok || !ok2 {
+		if over == nil {
+			return copyValue(base)
+		}
+		return copyValue(over)
+	}
+	m := copyValue(bm).(map[string]any)
+	for k, v := range om {
+		cur, ok := m[k]
+		switch {
+		case !ok:
+			m[k] = copyValue(v)
+		case k == "environmentVariablesOverride":
+			m[k] = mergeEnvVars(cur, v)
+		default:
+			m[k] = mergeValues(cur, v)
+		}
+	}
+	return m
+}
+
+// merge environment variables of over into base by name.
+// variables of over replace ones with the same names in base and others are appended
+func mergeEnvVars(base any, over any) any {
+	return mergeListByKey(base, over, "name", func(_, o any) any { return copyValue(o) })
+}
+
+// merge maps of over list into a copy of base list by the value of key.
+// maps with the same scalar value as ones of base are merged by merge and others are appended
+func mergeListByKey(base any, over any, key string, merge func(b, o any) any) any {
+	bl, ok := base.([]any)
+	ol, ok2 := over.([]any)
+	if !ok || !ok2 {
+		return mergeValues(base, over)
+	}
+	merged := copyValue(bl).([]any)
+	for _, o := range ol {
+		i := -1
+		if om, ok := o.(map[string]any); ok {
+			if k, err := scalarString(om[key]); err == nil {
+				i = slices.IndexFunc(merged, func(b any) bool {
+					bm, ok := b.(map[string]any)
+					if !ok {
+						return false
+					}
+					bk, err := scalarString(bm[key])
+					return err == nil && bk == k
+				})
+			}
+		}
+		if i >= 0 {
+			merged[i] = merge(merged[i], o)
+		} else {
+			merged = append(merged, copyValue(o))
+		}
+	}
+	return merged
+}
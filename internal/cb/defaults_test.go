@@ -0,0 +1,139 @@
+package cb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_mergeValues(t *testing.T) {
+	tests := []struct {
+		name string
+		base any
+		over any
+		want any
+	}{
+		{
+			name: "deep merge of maps",
+			base: map[string]any{"cacheOverride": map[string]any{"type": "S3", "location": "bucket"}, "imageOverride": "a"},
+			over: map[string]any{"cacheOverride": map[string]any{"location": "bucket2"}, "computeTypeOverride": "b"},
+			want: map[string]any{"cacheOverride": map[string]any{"type": "S3", "location": "bucket2"}, "imageOverride": "a", "computeTypeOverride": "b"},
+		},
+		{
+			name: "environment variables by name",
+			base: map[string]any{"environmentVariablesOverride": []any{
+				map[string]any{"name": "A", "value": "1"},
+				map[string]any{"name": "B", "value": "2"},
+			}},
+			over: map[string]any{"environmentVariablesOverride": []any{
+				map[string]any{"name": "B", "value": "3", "type": "PARAMETER_STORE"},
+				map[string]any{"name": "C", "value": "4"},
+			}},
+			want: map[string]any{"environmentVariablesOverride": []any{
+				map[string]any{"name": "A", "value": "1"},
+				map[string]any{"name": "B", "value": "3", "type": "PARAMETER_STORE"},
+				map[string]any{"name": "C", "value": "4"},
+			}},
+		},
+		{
+			name: "other lists are replaced",
+			base: map[string]any{"secondarySourcesOverride": []any{"a", "b"}},
+			over: map[string]any{"secondarySourcesOverride": []any{"c"}},
+			want: map[string]any{"secondarySourcesOverride": []any{"c"}},
+		},
+		{
+			name: "null does not override",
+			base: map[string]any{"imageOverride": "a"},
+			over: map[string]any{"imageOverride": nil},
+			want: map[string]any{"imageOverride": "a"},
+		},
+		{
+			name: "null environment variables do not override",
+			base: map[string]any{"environmentVariablesOverride": []any{map[string]any{"name": "A", "value": "1"}}},
+			over: map[string]any{"environmentVariablesOverride": nil},
+			want: map[string]any{"environmentVariablesOverride": []any{map[string]any{"name": "A", "value": "1"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeValues(tt.base, tt.over); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeValues() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// base is not changed
+	base := map[string]any{"cacheOverride": map[string]any{"type": "S3"}}
+	mergeValues(base, map[string]any{"cacheOverride": map[string]any{"type": "LOCAL"}})
+	if base["cacheOverride"].(map[string]any)["type"] != "S3" {
+		t.Errorf("mergeValues() changed base to %v", base)
+	}
+}
+
+func Test_applyDefaults(t *testing.T) {
+	tests := []struct {
+		name            string
+		data            map[string]any
+		want            map[string]any
+		wantErrContains string
+	}{
+		{
+			name: "list format",
+			data: map[string]any{
+				"defaults": map[string]any{"imageOverride": "a"},
+				"builds":   []any{map[string]any{"projectName": "proj"}},
+			},
+			want: map[string]any{
+				"builds": []any{map[string]any{"projectName": "proj", "imageOverride": "a"}},
+			},
+		},
+		{
+			name: "group defaults without top-level defaults",
+			data: map[string]any{
+				"groups": map[string]any{"g1": map[string]any{"defaults": map[string]any{"imageOverride": "b"}}},
+				"builds": map[string]any{
+					"g1": []any{map[string]any{"projectName": "proj"}},
+					"g2": []any{map[string]any{"projectName": "proj2"}},
+				},
+			},
+			want: map[string]any{
+				"groups": map[string]any{"g1": map[string]any{}},
+				"builds": map[string]any{
+					"g1": []any{map[string]any{"projectName": "proj", "imageOverride": "b"}},
+					"g2": []any{map[string]any{"projectName": "proj2"}},
+				},
+			},
+		},
+		{
+			name:            "invalid defaults",
+			data:            map[string]any{"defaults": []any{"a"}, "builds": []any{}},
+			wantErrContains: "`defaults` field must be a map of build fields",
+		},
+		{
+			name: "invalid group defaults",
+			data: map[string]any{
+				"groups": map[string]any{"g1": map[string]any{"defaults": "a"}},
+				"builds": map[string]any{},
+			},
+			wantErrContains: "defaults of group 'g1' must be a map of build fields",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := applyDefaults(tt.data)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("applyDefaults() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("applyDefaults() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(tt.data, tt.want) {
+				t.Errorf("applyDefaults() = %v, want %v", tt.data, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package cb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+// check ids and dependsOn of builds and return error if they can not form a DAG
+func validateDependencies(builds []types.Build) error {
+	byID := make(map[string]types.Build)
+	for _, b := range builds {
+		if b.ID == "" {
+			if len(b.DependsOn) > 0 {
+				return fmt.Errorf("build of project '%s' has dependsOn but no id", b.ProjectName)
+			}
+			continue
+		}
+		if _, ok := byID[b.ID]; ok {
+			return fmt.Errorf("duplicate build id '%s'", b.ID)
+		}
+		byID[b.ID] = b
+	}
+	for _, b := range builds {
+		for _, dep := range b.DependsOn {
+			if _, ok := byID[dep]; !ok {
+				return fmt.Errorf("build '%s' depends on unknown build id '%s'", b.ID, dep)
+			}
+		}
+	}
+
+	// depth first search with 3 states to find a back edge
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	path := []string{}
+	var visit func(id string) error
+	visit = func(id string) error {
+		switch state[id] {
+		case visited:
+			return nil
+		case visiting:
+			// cut the path from the first appearance of id to show the cycle only
+			for i, p := range path {
+				if p == id {
+					return fmt.Errorf("dependency cycle detected: %s -> %s", strings.Join(path[i:], " -> "), id)
+				}
+			}
+		}
+		state[id] = visiting
+		path = append(path, id)
+		for _, dep := range byID[id].DependsOn {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[id] = visited
+		return nil
+	}
+	for _, b := range builds {
+		if b.ID == "" {
+			continue
+		}
+		if err := visit(b.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package cb
+
+import (
+	"strings"
+	"testing"
+
+	cmt "github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func Test_validateDependencies(t *testing.T) {
+	build := func(id string, deps ...string) cmt.Build {
+		return cmt.Build{RunnerOptions: cmt.RunnerOptions{ID: id, DependsOn: deps}, ProjectName: "project-" + id}
+	}
+	tests := []struct {
+		name            string
+		builds          []cmt.Build
+		wantErrContains string
+	}{
+		{
+			name:   "no dependencies",
+			builds: []cmt.Build{{ProjectName: "a"}, {ProjectName: "b"}},
+		},
+		{
+			name:   "chain",
+			builds: []cmt.Build{build("app", "migrate"), build("migrate", "infra"), build("infra")},
+		},
+		{
+			name:   "diamond",
+			builds: []cmt.Build{build("a"), build("b", "a"), build("c", "a"), build("d", "b", "c")},
+		},
+		{
+			name:            "duplicate id",
+			builds:          []cmt.Build{build("a"), build("a")},
+			wantErrContains: "duplicate build id 'a'",
+		},
+		{
+			name:            "unknown dependency",
+			builds:          []cmt.Build{build("a", "x")},
+			wantErrContains: "build 'a' depends on unknown build id 'x'",
+		},
+		{
+			name:            "dependsOn without id",
+			builds:          []cmt.Build{build("a"), {RunnerOptions: cmt.RunnerOptions{DependsOn: []string{"a"}}, ProjectName: "b"}},
+			wantErrContains: "build of project 'b' has dependsOn but no id",
+		},
+		{
+			name:            "self dependency",
+			builds:          []cmt.Build{build("a", "a")},
+			wantErrContains: "dependency cycle detected: a -> a",
+		},
+		{
+			name:            "cycle",
+			builds:          []cmt.Build{build("root"), build("a", "root", "b"), build("b", "c"), build("c", "a")},
+			wantErrContains: "dependency cycle detected: a -> b -> c -> a",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateDependencies(tt.builds)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("validateDependencies() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.wantErrContains) {
+				t.Errorf("validateDependencies() error = %v, wantErr containing %q", err, tt.wantErrContains)
+			}
+		})
+	}
+}
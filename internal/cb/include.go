@@ -0,0 +1,138 @@
+package cb
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// fields of included files merged into the including config by name
+var includedFields = []string{"templates", "groups", "builds"}
+
+// config files where entries of fields are defined when other files are included
+type configSources struct {
+	root configSource
+	// sources keyed by field and name of entries such as templates and groups of builds.
+	// entries not found are defined in the root file
+	fields map[string]map[string]configSource
+}
+
+// return source defining the entry of the field
+func (s configSources) of(field, name string) configSource {
+	if src, ok := s.fields[field][name]; ok {
+		return src
+	}
+	return s.root
+}
+
+// record src as the source defining the entry of the field unless another source is recorded
+func (s configSources) define(field, name string, src configSource) {
+	if s.fields[field] == nil {
+		s.fields[field] = map[string]configSource{}
+	}
+	if _, ok := s.fields[field][name]; !ok {
+		s.fields[field][name] = src
+	}
+}
+
+// load files matching the include field of config data at src and merge their templates, groups and builds into data.
+// paths are relative to the including file, included files can include other files and each file is loaded only once.
+// loaded has absolute paths of files already loaded
+func applyIncludes(data map[string]any, src configSource, sources configSources, loaded map[string]bool) error {
+	if abs, err := filepath.Abs(src.name); err == nil {
+		loaded[abs] = true
+	}
+	for _, field := range includedFields {
+		if entries, ok := data[field].(map[string]any); ok {
+			for name := range entries {
+				sources.define(field, name, src)
+			}
+		}
+	}
+	v, ok := data["include"]
+	if !ok {
+		return nil
+	}
+	delete(data, "include")
+	patterns, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("%s: `include` field must be a list of file paths", src.position("include"))
+	}
+	if _, ok := data["builds"].([]any); ok {
+		return fmt.Errorf("%s: `include` field is only available for the map format configuration file", src.position("builds"))
+	}
+	for _, field := range includedFields {
+		if v, ok := data[field]; ok {
+			if _, ok := v.(map[string]any); !ok {
+				return fmt.Errorf("%s: `%s` field must be a map", src.position(field), field)
+			}
+		}
+	}
+
+	for i, p := range patterns {
+		pattern, ok := p.(string)
+		if !ok {
+			return fmt.Errorf("%s: `include` field must be a list of file paths", src.position("include", i))
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(src.name), pattern)
+		}
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("%s: invalid include pattern '%s': %w", src.position("include", i), p, err)
+		}
+		if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("%s: included file '%s' not found", src.position("include", i), pattern)
+		}
+		for _, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				return err
+			}
+			if loaded[abs] {
+				continue
+			}
+			inc, incSrc, err := readConfigData(file)
+			if err != nil {
+				return fmt.Errorf("failed to read included file '%s': %w", file, err)
+			}
+			if err := applyIncludes(inc, incSrc, sources, loaded); err != nil {
+				return err
+			}
+			if err := mergeIncluded(data, inc, incSrc, sources); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// merge templates, groups and builds of included config data into data, rejecting duplicate names
+func mergeIncluded(data map[string]any, inc map[string]any, src configSource, sources configSources) error {
+	if _, ok := inc["defaults"]; ok {
+		return fmt.Errorf("%s: `defaults` field is only available in the root config file, use defaults of groups instead", src.position("defaults"))
+	}
+	for _, field := range includedFields {
+		v, ok := inc[field]
+		if !ok {
+			continue
+		}
+		entries, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: `%s` field must be a map", src.position(field), field)
+		}
+		merged, ok := data[field].(map[string]any)
+		if !ok {
+			merged = map[string]any{}
+			data[field] = merged
+		}
+		for name, e := range entries {
+			if _, ok := merged[name]; ok {
+				return fmt.Errorf("%s: duplicate name '%s' in `%s` field, already defined in %s",
+					src.position(field, name), name, field, sources.of(field, name).position(field, name))
+			}
+			merged[name] = e
+		}
+	}
+	return nil
+}
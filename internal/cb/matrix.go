@@ -0,0 +1,220 @@
+package cb
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+)
+
+// placeholder of a matrix value in fields of a build entry
+var matrixPlaceholder = regexp.MustCompile(`\{\{\s*matrix\.([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// expand build entries with matrix into one entry per combination of matrix values.
+// values of each combination are added to environmentVariablesOverride and replace {{ matrix.NAME }} in other fields
+func expandMatrix(entries []any) ([]any, error) {
+	expanded := []any{}
+	for _, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			expanded = append(expanded, e)
+			continue
+		}
+		m, ok := entry["matrix"]
+		if !ok {
+			expanded = append(expanded, e)
+			continue
+		}
+		combos, err := matrixCombinations(m)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matrix of build of project '%v': %w", entry["projectName"], err)
+		}
+		for _, combo := range combos {
+			b := copyValue(entry).(map[string]any)
+			delete(b, "matrix")
+			v, err := replaceMatrixPlaceholders(b, combo)
+			if err != nil {
+				return nil, fmt.Errorf("build of project '%v': %w", entry["projectName"], err)
+			}
+			b = v.(map[string]any)
+			b["environmentVariablesOverride"] = withMatrixEnv(b["environmentVariablesOverride"], combo)
+			expanded = append(expanded, b)
+		}
+	}
+	return expanded, nil
+}
+
+// return combinations of matrix values. variables are combined in alphabetical order of their names,
+// combinations matching all values of any exclude entry are removed and include entries are added
+func matrixCombinations(m any) ([]map[string]string, error) {
+	matrix, ok := m.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("matrix must be a map of variable names to lists of values")
+	}
+	combos := []map[string]string{{}}
+	names := slices.Sorted(maps.Keys(matrix))
+	for _, name := range names {
+		if name == "include" || name == "exclude" {
+			continue
+		}
+		values, ok := matrix[name].([]any)
+		if !ok || len(values) == 0 {
+			return nil, fmt.Errorf("values of '%s' must be a non-empty list", name)
+		}
+		next := []map[string]string{}
+		for _, c := range combos {
+			for _, v := range values {
+				s, err := scalarString(v)
+				if err != nil {
+					return nil, fmt.Errorf("value of '%s': %w", name, err)
+				}
+				n := maps.Clone(c)
+				n[name] = s
+				next = append(next, n)
+			}
+		}
+		combos = next
+	}
+	// no variables other than include and exclude
+	if len(combos[0]) == 0 {
+		combos = nil
+	}
+
+	exclude, err := matrixEntries(matrix["exclude"], "exclude")
+	if err != nil {
+		return nil, err
+	}
+	combos = slices.DeleteFunc(combos, func(c map[string]string) bool {
+		return slices.ContainsFunc(exclude, func(e map[string]string) bool {
+			for k, v := range e {
+				if c[k] != v {
+					return false
+				}
+			}
+			return true
+		})
+	})
+	include, err := matrixEntries(matrix["include"], "include")
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range include {
+		if !slices.ContainsFunc(combos, func(c map[string]string) bool { return maps.Equal(c, i) }) {
+			combos = append(combos, i)
+		}
+	}
+	if len(combos) == 0 {
+		return nil, fmt.Errorf("matrix has no combinations")
+	}
+	return combos, nil
+}
+
+// parse include or exclude entries of matrix
+func matrixEntries(v any, key string) ([]map[string]string, error) {
+	if v == nil {
+		return nil, nil
+	}
+	list, ok := v.([]any)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list of maps", key)
+	}
+	entries := []map[string]string{}
+	for _, item := range list {
+		m, ok := item.(map[string]any)
+		if !ok || len(m) == 0 {
+			return nil, fmt.Errorf("%s must be a list of maps", key)
+		}
+		entry := make(map[string]string, len(m))
+		for k, v := range m {
+			s, err := scalarString(v)
+			if err != nil {
+				return nil, fmt.Errorf("value of '%s' in %s: %w", k, key, err)
+			}
+			entry[k] = s
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// return string of a scalar value of yaml
+func scalarString(v any) (string, error) {
+	switch v.(type) {
+	case map[string]any, []any, nil:
+		return "", fmt.Errorf("must be a scalar, got %v", v)
+	}
+	return fmt.Sprint(v), nil
+}
+
+// return a deep copy of a value parsed from yaml
+func copyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(t))
+		for k, e := range t {
+			m[k] = copyValue(e)
+		}
+		return m
+	case []any:
+		l := make([]any, len(t))
+		for i, e := range t {
+			l[i] = copyValue(e)
+		}
+		return l
+	}
+	return v
+}
+
+// replace {{ matrix.NAME }} in string values with values of the combination
+func replaceMatrixPlaceholders(v any, combo map[string]string) (any, error) {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, e := range t {
+			r, err := replaceMatrixPlaceholders(e, combo)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = r
+		}
+	case []any:
+		for i, e := range t {
+			r, err := replaceMatrixPlaceholders(e, combo)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = r
+		}
+	case string:
+		var err error
+		s := matrixPlaceholder.ReplaceAllStringFunc(t, func(p string) string {
+			name := matrixPlaceholder.FindStringSubmatch(p)[1]
+			value, ok := combo[name]
+			if !ok && err == nil {
+				err = fmt.Errorf("unknown matrix variable '%s'", name)
+			}
+			return value
+		})
+		return s, err
+	}
+	return v, nil
+}
+
+// return environmentVariablesOverride with values of the combination as PLAINTEXT variables.
+// existing variables with the same names are overridden
+func withMatrixEnv(env any, combo map[string]string) []any {
+	vars, _ := env.([]any)
+	for _, name := range slices.Sorted(maps.Keys(combo)) {
+		i := slices.IndexFunc(vars, func(v any) bool {
+			m, ok := v.(map[string]any)
+			return ok && m["name"] == name
+		})
+		if i >= 0 {
+			m := vars[i].(map[string]any)
+			m["value"] = combo[name]
+			delete(m, "type")
+			continue
+		}
+		vars = append(vars, map[string]any{"name": name, "value": combo[name]})
+	}
+	return vars
+}
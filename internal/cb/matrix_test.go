@@ -0,0 +1,153 @@
+package cb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_matrixCombinations(t *testing.T) {
+	tests := []struct {
+		name            string
+		matrix          any
+		want            []map[string]string
+		wantErrContains string
+	}{
+		{
+			name:   "product in alphabetical order of names",
+			matrix: map[string]any{"REGION": []any{"us-east-1", "eu-west-1"}, "ARCH": []any{"amd64", "arm64"}},
+			want: []map[string]string{
+				{"ARCH": "amd64", "REGION": "us-east-1"},
+				{"ARCH": "amd64", "REGION": "eu-west-1"},
+				{"ARCH": "arm64", "REGION": "us-east-1"},
+				{"ARCH": "arm64", "REGION": "eu-west-1"},
+			},
+		},
+		{
+			name: "exclude and include",
+			matrix: map[string]any{
+				"REGION":  []any{"us-east-1", "eu-west-1"},
+				"VERSION": []any{uint64(1), uint64(2)},
+				"exclude": []any{map[string]any{"REGION": "eu-west-1"}},
+				"include": []any{
+					map[string]any{"REGION": "ap-northeast-1", "VERSION": uint64(2)},
+					map[string]any{"REGION": "us-east-1", "VERSION": uint64(1)},
+				},
+			},
+			want: []map[string]string{
+				{"REGION": "us-east-1", "VERSION": "1"},
+				{"REGION": "us-east-1", "VERSION": "2"},
+				{"REGION": "ap-northeast-1", "VERSION": "2"},
+			},
+		},
+		{
+			name:   "include only",
+			matrix: map[string]any{"include": []any{map[string]any{"REGION": "us-east-1"}}},
+			want:   []map[string]string{{"REGION": "us-east-1"}},
+		},
+		{
+			name:            "not a list",
+			matrix:          map[string]any{"REGION": "us-east-1"},
+			wantErrContains: "values of 'REGION' must be a non-empty list",
+		},
+		{
+			name:            "not a scalar",
+			matrix:          map[string]any{"REGION": []any{[]any{"us-east-1"}}},
+			wantErrContains: "value of 'REGION': must be a scalar",
+		},
+		{
+			name:            "all excluded",
+			matrix:          map[string]any{"REGION": []any{"us-east-1"}, "exclude": []any{map[string]any{"REGION": "us-east-1"}}},
+			wantErrContains: "matrix has no combinations",
+		},
+		{
+			name:            "invalid exclude",
+			matrix:          map[string]any{"REGION": []any{"us-east-1"}, "exclude": "REGION"},
+			wantErrContains: "exclude must be a list of maps",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matrixCombinations(tt.matrix)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("matrixCombinations() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("matrixCombinations() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matrixCombinations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_expandMatrix(t *testing.T) {
+	tests := []struct {
+		name            string
+		entries         []any
+		want            []any
+		wantErrContains string
+	}{
+		{
+			name: "placeholders and environment variables",
+			entries: []any{
+				map[string]any{
+					"projectName":   "proj",
+					"sourceVersion": "release/{{ matrix.REGION }}",
+					"environmentVariablesOverride": []any{
+						map[string]any{"name": "REGION", "value": "/param", "type": "PARAMETER_STORE"},
+					},
+					"matrix": map[string]any{"REGION": []any{"us-east-1", "eu-west-1"}},
+				},
+				map[string]any{"projectName": "other"},
+			},
+			want: []any{
+				map[string]any{
+					"projectName":                  "proj",
+					"sourceVersion":                "release/us-east-1",
+					"environmentVariablesOverride": []any{map[string]any{"name": "REGION", "value": "us-east-1"}},
+				},
+				map[string]any{
+					"projectName":                  "proj",
+					"sourceVersion":                "release/eu-west-1",
+					"environmentVariablesOverride": []any{map[string]any{"name": "REGION", "value": "eu-west-1"}},
+				},
+				map[string]any{"projectName": "other"},
+			},
+		},
+		{
+			name: "unknown variable",
+			entries: []any{
+				map[string]any{
+					"projectName":   "proj",
+					"sourceVersion": "{{ matrix.ARCH }}",
+					"matrix":        map[string]any{"REGION": []any{"us-east-1"}},
+				},
+			},
+			wantErrContains: "build of project 'proj': unknown matrix variable 'ARCH'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandMatrix(tt.entries)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("expandMatrix() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("expandMatrix() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandMatrix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package cb
+
+import (
+	"fmt"
+	"maps"
+)
+
+// merge config data of an overlay file into a copy of base.
+// builds are merged by group name and entries of groups by id, and other fields are merged deeply
+func mergeConfigData(base map[string]any, over map[string]any) (map[string]any, error) {
+	b := maps.Clone(base)
+	delete(b, "builds")
+	o := maps.Clone(over)
+	delete(o, "builds")
+	merged := mergeValues(b, o).(map[string]any)
+
+	overBuilds, ok := over["builds"]
+	if !ok {
+		if builds, ok := base["builds"]; ok {
+			merged["builds"] = copyValue(builds)
+		}
+		return merged, nil
+	}
+	switch baseBuilds := base["builds"].(type) {
+	case map[string]any:
+		groups, ok := overBuilds.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("can not merge builds of the list format into the map format")
+		}
+		builds := copyValue(baseBuilds).(map[string]any)
+		for name, entries := range groups {
+			builds[name] = mergeBuildEntries(builds[name], entries)
+		}
+		merged["builds"] = builds
+	case []any:
+		if _, ok := overBuilds.([]any); !ok {
+			return nil, fmt.Errorf("can not merge builds of the map format into the list format")
+		}
+		merged["builds"] = mergeBuildEntries(baseBuilds, overBuilds)
+	default:
+		merged["builds"] = copyValue(overBuilds)
+	}
+	return merged, nil
+}
+
+// merge build entries of over into base. entries with the same id are merged deeply and others are appended
+func mergeBuildEntries(base any, over any) any {
+	return mergeListByKey(base, over, "id", mergeValues)
+}
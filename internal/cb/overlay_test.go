@@ -0,0 +1,152 @@
+package cb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	cmt "github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func Test_mergeConfigData(t *testing.T) {
+	tests := []struct {
+		name            string
+		base            map[string]any
+		over            map[string]any
+		want            map[string]any
+		wantErrContains string
+	}{
+		{
+			name: "entries with and without id",
+			base: map[string]any{"builds": []any{
+				map[string]any{"id": "a", "projectName": "proj", "sourceVersion": "main"},
+				map[string]any{"projectName": "proj2"},
+			}},
+			over: map[string]any{"builds": []any{
+				map[string]any{"id": "a", "sourceVersion": "release"},
+				map[string]any{"projectName": "proj2"},
+			}},
+			want: map[string]any{"builds": []any{
+				map[string]any{"id": "a", "projectName": "proj", "sourceVersion": "release"},
+				map[string]any{"projectName": "proj2"},
+				map[string]any{"projectName": "proj2"},
+			}},
+		},
+		{
+			name: "new groups and other fields",
+			base: map[string]any{
+				"defaults": map[string]any{"imageOverride": "a"},
+				"builds":   map[string]any{"g1": []any{map[string]any{"projectName": "proj"}}},
+			},
+			over: map[string]any{
+				"defaults": map[string]any{"computeTypeOverride": "b"},
+				"builds":   map[string]any{"g2": []any{map[string]any{"projectName": "proj2"}}},
+			},
+			want: map[string]any{
+				"defaults": map[string]any{"imageOverride": "a", "computeTypeOverride": "b"},
+				"builds": map[string]any{
+					"g1": []any{map[string]any{"projectName": "proj"}},
+					"g2": []any{map[string]any{"projectName": "proj2"}},
+				},
+			},
+		},
+		{
+			name: "without builds",
+			base: map[string]any{"builds": []any{map[string]any{"projectName": "proj"}}},
+			over: map[string]any{"templates": map[string]any{"t": map[string]any{"imageOverride": "a"}}},
+			want: map[string]any{
+				"builds":    []any{map[string]any{"projectName": "proj"}},
+				"templates": map[string]any{"t": map[string]any{"imageOverride": "a"}},
+			},
+		},
+		{
+			name:            "different formats",
+			base:            map[string]any{"builds": map[string]any{}},
+			over:            map[string]any{"builds": []any{}},
+			wantErrContains: "can not merge builds of the list format into the map format",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeConfigData(tt.base, tt.over)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("mergeConfigData() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("mergeConfigData() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeConfigData() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileOverlay(t *testing.T) {
+	image := "aws/codebuild/standard:7.0"
+	tests := []struct {
+		name            string
+		files           []string
+		want            any
+		wantGroups      map[string]cmt.GroupOptions
+		wantErrContains string
+	}{
+		{
+			name:  "groups and entries with id",
+			files: []string{"testdata/_test_overlay_base.yaml", "testdata/_test_overlay_prod.yaml"},
+			want: map[string][]cmt.Build{
+				"test": {
+					{
+						ProjectName:                  "proj-test",
+						ImageOverride:                image,
+						EnvironmentVariablesOverride: []cmt.EnvironmentVariablesOverride{{Name: "STAGE", Value: "prod"}},
+						RunnerOptions:                cmt.RunnerOptions{ID: "unit"},
+					},
+				},
+				"deploy": {
+					{ProjectName: "proj-api", SourceVersion: "release", ImageOverride: image, RunnerOptions: cmt.RunnerOptions{ID: "api"}},
+					{ProjectName: "proj-web", ImageOverride: image, RunnerOptions: cmt.RunnerOptions{ID: "web"}},
+				},
+			},
+			wantGroups: map[string]cmt.GroupOptions{"deploy": {MaxParallel: 2}},
+		},
+		{
+			name:  "file included by both files is loaded once",
+			files: []string{"testdata/_test_overlay_include_base.yaml", "testdata/_test_overlay_include_prod.yaml"},
+			want: map[string][]cmt.Build{
+				"app":    {{ProjectName: "proj-app", SourceVersion: "release", RunnerOptions: cmt.RunnerOptions{ID: "app"}}},
+				"shared": {{ProjectName: "proj-shared"}},
+			},
+		},
+		{
+			name:            "error in a later file",
+			files:           []string{"testdata/_test_overlay_templates_base.yaml", "testdata/_test_overlay_templates_prod.yaml"},
+			wantErrContains: "testdata/_test_overlay_templates_prod.yaml:5:23: unknown template 'missing'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadConfigFile(tt.files...)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("ReadConfigFile() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("ReadConfigFile() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.Builds, tt.want) {
+				t.Errorf("ReadConfigFile() got = %#v, want %#v", got.Builds, tt.want)
+			}
+			if !reflect.DeepEqual(got.Groups, tt.wantGroups) {
+				t.Errorf("ReadConfigFile() got groups = %#v, want %#v", got.Groups, tt.wantGroups)
+			}
+		})
+	}
+}
@@ -0,0 +1,566 @@
+package cb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+// statuses of tasks in addition to CodeBuild build statuses
+const (
+	StatusPending       = "PENDING"
+	StatusSkipped       = "SKIPPED"
+	StatusFailedToStart = "FAILED_TO_START"
+	StatusNotFound      = "NOT_FOUND"
+	StatusStopping      = "STOPPING"
+	StatusQueued        = "QUEUED"
+	StatusRetrying      = "RETRYING"
+	statusInProgress    = "IN_PROGRESS"
+	statusSucceeded     = "SUCCEEDED"
+)
+
+// maximum polling span in second while waiting for canceled builds to stop
+const maxStopPollSec = 5
+
+// RunOptions are options for following tasks
+type RunOptions struct {
+	// polling span in second for builds status check
+	PollSec int
+	// stop in-progress builds when ctx is canceled
+	StopOnCancel bool
+	// stop all in-progress builds as soon as any build failed
+	FailFast bool
+	// maximum number of in-progress builds. 0 means unlimited
+	MaxParallel int
+	// maximum number of in-progress builds of each group, keyed by group name. 0 means unlimited
+	GroupMaxParallel map[string]int
+	// number of retries of FAILED, FAULT or TIMED_OUT builds without retries in config
+	Retries int
+	// wait in second before the first retry. doubled for each following retry
+	RetryBackoffSec int
+	// called with tasks each time their statuses are updated
+	OnUpdate func(tasks []*Task)
+}
+
+// Attempt is a failed build of a task which was retried
+type Attempt struct {
+	BuildID string
+	Status  string
+}
+
+// Task is a build entry tracked from start to end in a run
+type Task struct {
+	Group   string
+	Build   types.Build
+	BuildID string
+	Status  string
+	Err     error
+	// latest information of the current build from BatchGetBuilds
+	Info *cbtypes.Build
+	// latest information of the current batch build from BatchGetBuildBatches for batch entries
+	BatchInfo *cbtypes.BuildBatch
+	// failed builds before the current one
+	Attempts []Attempt
+	deps     []*Task
+	queued   bool
+	// time to retry and status of the failed build while RETRYING
+	retryAt     time.Time
+	retryStatus string
+}
+
+// return a name of the task for logging
+func (t *Task) Name() string {
+	if t.Build.ID != "" {
+		return t.Build.ID
+	}
+	return t.Build.ProjectName
+}
+
+// return if the task ended without success
+func (t *Task) Failed() bool {
+	switch t.Status {
+	case StatusPending, statusInProgress, StatusRetrying, statusSucceeded:
+		return false
+	}
+	return true
+}
+
+// return if the task will not change its status anymore
+func (t *Task) Ended() bool {
+	switch t.Status {
+	case StatusPending, statusInProgress, StatusRetrying:
+		return false
+	}
+	return true
+}
+
+// return build ids of all attempts of the task from the original one
+func (t *Task) BuildIDs() []string {
+	ids := []string{}
+	for _, a := range t.Attempts {
+		ids = append(ids, a.BuildID)
+	}
+	if t.BuildID != "" {
+		ids = append(ids, t.BuildID)
+	}
+	return ids
+}
+
+// return phases of the current build which ended without success
+func (t *Task) FailedPhases() []cbtypes.BuildPhase {
+	if t.Info == nil {
+		return nil
+	}
+	phases := []cbtypes.BuildPhase{}
+	for _, p := range t.Info.Phases {
+		if p.PhaseStatus != "" && p.PhaseStatus != cbtypes.StatusTypeSucceeded {
+			phases = append(phases, p)
+		}
+	}
+	return phases
+}
+
+// return a message of a phase with its contexts
+func PhaseMessage(p cbtypes.BuildPhase) string {
+	msg := fmt.Sprintf("%s %s", p.PhaseType, p.PhaseStatus)
+	for _, c := range p.Contexts {
+		if c.StatusCode != nil && *c.StatusCode != "" {
+			msg += ": " + *c.StatusCode
+		}
+		if c.Message != nil && *c.Message != "" {
+			msg += ": " + *c.Message
+		}
+	}
+	return msg
+}
+
+// schedule a retry of the build if it ended with a retryable status and retries are left
+func (t *Task) scheduleRetry(opts RunOptions) {
+	switch cbtypes.StatusType(t.Status) {
+	case cbtypes.StatusTypeFailed, cbtypes.StatusTypeFault, cbtypes.StatusTypeTimedOut:
+	default:
+		return
+	}
+	retries := t.Build.Retries
+	if retries == 0 {
+		retries = opts.Retries
+	}
+	if len(t.Attempts) >= retries {
+		return
+	}
+	backoff := time.Duration(opts.RetryBackoffSec) * time.Second << len(t.Attempts)
+	t.retryAt = time.Now().Add(backoff)
+	t.retryStatus = t.Status
+	t.Status = StatusRetrying
+	log.Printf("%s [%s] (%d/%d) in %s\n", t.BuildID, ColoredString(t.Status), len(t.Attempts)+1, retries, backoff)
+}
+
+// retry builds of tasks whose backoff has elapsed
+func retryDueTasks(client CodeBuildAPI, tasks []*Task) {
+	for _, t := range tasks {
+		if t.Status != StatusRetrying || time.Now().Before(t.retryAt) {
+			continue
+		}
+		retry := RetryCodeBuild
+		if t.Build.Batch {
+			retry = RetryCodeBuildBatch
+		}
+		id, err := retry(client, t.BuildID)
+		if err != nil {
+			t.giveUpRetry()
+			t.Err = fmt.Errorf("failed to retry build %s: %w", t.BuildID, err)
+			log.Println(t.Err)
+			continue
+		}
+		t.Attempts = append(t.Attempts, Attempt{BuildID: t.BuildID, Status: t.retryStatus})
+		t.BuildID = id
+		t.Status = statusInProgress
+		t.Info = nil
+		t.BatchInfo = nil
+	}
+}
+
+// give up retrying and restore the status of the failed build
+func (t *Task) giveUpRetry() {
+	t.Status = t.retryStatus
+}
+
+// return if any of tasks failed
+func HasFailedTask(tasks []*Task) bool {
+	for _, t := range tasks {
+		if t.Failed() {
+			return true
+		}
+	}
+	return false
+}
+
+// create tasks for builds of groups and resolve dependsOn between them
+func NewTasks(groups []BuildGroup) ([]*Task, error) {
+	tasks := []*Task{}
+	byID := make(map[string]*Task)
+	for _, g := range groups {
+		for _, b := range g.Builds {
+			t := &Task{Group: g.Name, Build: b, Status: StatusPending}
+			if b.ID != "" {
+				if _, ok := byID[b.ID]; ok {
+					return nil, fmt.Errorf("duplicate build id '%s'", b.ID)
+				}
+				byID[b.ID] = t
+			}
+			tasks = append(tasks, t)
+		}
+	}
+	for _, t := range tasks {
+		for _, dep := range t.Build.DependsOn {
+			d, ok := byID[dep]
+			if !ok {
+				return nil, fmt.Errorf("build '%s' depends on '%s' which is not in the builds to run", t.Build.ID, dep)
+			}
+			t.deps = append(t.deps, d)
+		}
+	}
+	return tasks, nil
+}
+
+// split tasks into stages of each group keeping the order.
+// return error if a build depends on a build in a later stage as it would never start
+func SplitTasksIntoStages(tasks []*Task) ([][]*Task, error) {
+	stages := [][]*Task{}
+	stageOf := make(map[*Task]int)
+	for i, t := range tasks {
+		if i == 0 || t.Group != tasks[i-1].Group {
+			stages = append(stages, []*Task{})
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], t)
+		stageOf[t] = len(stages) - 1
+	}
+	for _, t := range tasks {
+		for _, d := range t.deps {
+			if stageOf[d] > stageOf[t] {
+				return nil, fmt.Errorf("build '%s' in group '%s' depends on '%s' in later group '%s'", t.Name(), t.Group, d.Name(), d.Group)
+			}
+		}
+	}
+	return stages, nil
+}
+
+// skip tasks whose upstream failed, start tasks whose upstreams all succeeded in parallel
+// within the limits of MaxParallel and GroupMaxParallel, and return number of started tasks.
+// tasks past the limits stay pending to be started on a later call.
+// tasks waiting for a retry keep counting against the limits so that their retries do not exceed them
+func StartReadyTasks(client CodeBuildAPI, tasks []*Task, opts RunOptions) int {
+	ready := []*Task{}
+	// repeat until no more task is skipped as skipping can propagate to downstreams
+	for changed := true; changed; {
+		changed = false
+		ready = ready[:0]
+		for _, t := range tasks {
+			if t.Status != StatusPending {
+				continue
+			}
+			switch depsStatus(t) {
+			case statusSucceeded:
+				ready = append(ready, t)
+			case StatusSkipped:
+				t.Status = StatusSkipped
+				log.Printf("%s [%s]\n", t.Name(), ColoredString(t.Status))
+				changed = true
+			}
+		}
+	}
+
+	running := 0
+	runningByGroup := make(map[string]int)
+	for _, t := range tasks {
+		if t.Status == statusInProgress || t.Status == StatusRetrying {
+			running++
+			runningByGroup[t.Group]++
+		}
+	}
+	starting := []*Task{}
+	for _, t := range ready {
+		limit := opts.GroupMaxParallel[t.Group]
+		if (opts.MaxParallel > 0 && running >= opts.MaxParallel) || (limit > 0 && runningByGroup[t.Group] >= limit) {
+			if !t.queued {
+				t.queued = true
+				log.Printf("%s [%s]\n", t.Name(), ColoredString(StatusQueued))
+			}
+			continue
+		}
+		running++
+		runningByGroup[t.Group]++
+		starting = append(starting, t)
+	}
+
+	var wg sync.WaitGroup
+	for _, t := range starting {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t.start(client)
+		}()
+	}
+	wg.Wait()
+	return len(starting)
+}
+
+// return SUCCEEDED if all upstreams succeeded, SKIPPED if any of them failed and PENDING otherwise
+func depsStatus(t *Task) string {
+	status := statusSucceeded
+	for _, d := range t.deps {
+		if d.Failed() {
+			return StatusSkipped
+		}
+		if d.Status != statusSucceeded {
+			status = StatusPending
+		}
+	}
+	return status
+}
+
+// start build of the task
+func (t *Task) start(client CodeBuildAPI) {
+	if t.Build.Batch {
+		t.startBatch(client)
+		return
+	}
+	input, err := ConvertBuildConfigToStartBuildInput(t.Build)
+	if err != nil {
+		t.Status = StatusFailedToStart
+		t.Err = fmt.Errorf("failed to convert build config for %s: %w", t.Build.ProjectName, err)
+		log.Println(t.Err)
+		return
+	}
+	id, err := RunCodeBuild(client, input)
+	if err != nil {
+		t.Status = StatusFailedToStart
+		t.Err = fmt.Errorf("failed to start build for %s: %w", t.Build.ProjectName, err)
+		log.Println(t.Err)
+		return
+	}
+	t.BuildID = id
+	t.Status = statusInProgress
+}
+
+// start batch build of the task
+func (t *Task) startBatch(client CodeBuildAPI) {
+	input, err := ConvertBuildConfigToStartBuildBatchInput(t.Build)
+	if err != nil {
+		t.Status = StatusFailedToStart
+		t.Err = fmt.Errorf("failed to convert build config for %s: %w", t.Build.ProjectName, err)
+		log.Println(t.Err)
+		return
+	}
+	id, err := RunCodeBuildBatch(client, input)
+	if err != nil {
+		t.Status = StatusFailedToStart
+		t.Err = fmt.Errorf("failed to start batch build for %s: %w", t.Build.ProjectName, err)
+		log.Println(t.Err)
+		return
+	}
+	t.BuildID = id
+	t.Status = statusInProgress
+}
+
+// stop build or batch build of the task
+func (t *Task) stop(client CodeBuildAPI) error {
+	if t.Build.Batch {
+		return StopCodeBuildBatch(client, t.BuildID)
+	}
+	return StopCodeBuild(client, t.BuildID)
+}
+
+// start tasks in dependency order and follow them until all tasks end.
+// when ctx is canceled, in-progress builds are stopped if StopOnCancel is set and ctx.Err() is returned
+func FollowTasks(ctx context.Context, client CodeBuildAPI, tasks []*Task, opts RunOptions) error {
+	if opts.OnUpdate != nil {
+		defer opts.OnUpdate(tasks)
+	}
+	// last logged status and phase of each build
+	last := make(map[string]string)
+	for {
+		if ctx.Err() != nil {
+			return cancelTasks(ctx, client, tasks, opts)
+		}
+		if opts.FailFast && HasFailedTask(tasks) {
+			failFast(client, tasks)
+			return nil
+		}
+		retryDueTasks(client, tasks)
+		started := StartReadyTasks(client, tasks, opts)
+		if opts.FailFast && HasFailedTask(tasks) {
+			failFast(client, tasks)
+			return nil
+		}
+		ids, batchIDs := []string{}, []string{}
+		pending, retrying := false, false
+		for _, t := range tasks {
+			switch t.Status {
+			case statusInProgress:
+				if t.Build.Batch {
+					batchIDs = append(batchIDs, t.BuildID)
+				} else {
+					ids = append(ids, t.BuildID)
+				}
+			case StatusPending:
+				pending = true
+			case StatusRetrying:
+				retrying = true
+			}
+		}
+		if len(ids) == 0 && len(batchIDs) == 0 && !retrying {
+			// pending tasks remain when their upstreams have just failed to start.
+			// they will be skipped on the next loop
+			if pending && started > 0 {
+				continue
+			}
+			if pending {
+				return fmt.Errorf("some builds are waiting for upstream builds which are not running")
+			}
+			return nil
+		}
+		// statuses are updated by starting and retrying builds
+		if opts.OnUpdate != nil {
+			opts.OnUpdate(tasks)
+		}
+		select {
+		case <-ctx.Done():
+			return cancelTasks(ctx, client, tasks, opts)
+		case <-time.After(time.Duration(opts.PollSec) * time.Second):
+		}
+		// only retries are waiting for their backoff
+		if len(ids) == 0 && len(batchIDs) == 0 {
+			continue
+		}
+		builds, batches := map[string]cbtypes.Build{}, map[string]cbtypes.BuildBatch{}
+		var err error
+		if len(ids) > 0 {
+			if builds, err = buildStatusCheck(client, ids, last); err != nil {
+				return err
+			}
+		}
+		if len(batchIDs) > 0 {
+			if batches, err = buildBatchStatusCheck(client, batchIDs, last); err != nil {
+				return err
+			}
+		}
+		for _, t := range tasks {
+			if t.Status != statusInProgress {
+				continue
+			}
+			if b, ok := builds[t.BuildID]; ok && !t.Build.Batch {
+				t.Info = &b
+				t.Status = string(b.BuildStatus)
+				t.scheduleRetry(opts)
+			} else if b, ok := batches[t.BuildID]; ok && t.Build.Batch {
+				t.BatchInfo = &b
+				t.Status = string(b.BuildBatchStatus)
+				t.scheduleRetry(opts)
+			} else {
+				t.Status = StatusNotFound
+				log.Printf("%s [%s]\n", t.BuildID, ColoredString(t.Status))
+			}
+		}
+		if opts.OnUpdate != nil {
+			opts.OnUpdate(tasks)
+		}
+	}
+}
+
+// skip pending tasks and stop in-progress builds without waiting for them to end
+func failFast(client CodeBuildAPI, tasks []*Task) {
+	log.Println("A build failed. Stopping other builds as --fail-fast is set.")
+	for _, t := range tasks {
+		switch t.Status {
+		case StatusPending:
+			t.Status = StatusSkipped
+			log.Printf("%s [%s]\n", t.Name(), ColoredString(t.Status))
+		case StatusRetrying:
+			t.giveUpRetry()
+		case statusInProgress:
+			if err := t.stop(client); err != nil {
+				log.Printf("failed to stop build %s: %v\n", t.BuildID, err)
+				continue
+			}
+			t.Status = StatusStopping
+		}
+	}
+}
+
+// skip pending tasks, stop in-progress builds if StopOnCancel is set, print a summary and return ctx.Err()
+func cancelTasks(ctx context.Context, client CodeBuildAPI, tasks []*Task, opts RunOptions) error {
+	running := []*Task{}
+	for _, t := range tasks {
+		switch t.Status {
+		case StatusPending:
+			t.Status = StatusSkipped
+		case StatusRetrying:
+			t.giveUpRetry()
+		case statusInProgress:
+			running = append(running, t)
+		}
+	}
+	if len(running) == 0 {
+		return ctx.Err()
+	}
+	if !opts.StopOnCancel {
+		log.Printf("Canceled. %d build(s) are left running:\n", len(running))
+		for _, t := range running {
+			log.Printf("%s [%s]\n", t.BuildID, ColoredString(t.Status))
+		}
+		return ctx.Err()
+	}
+
+	log.Printf("Canceled. Stopping %d build(s)...\n", len(running))
+	statuses, err := stopTasksAndWait(client, running, min(opts.PollSec, maxStopPollSec))
+	if err != nil {
+		return fmt.Errorf("failed to wait for builds to stop: %w", err)
+	}
+	stopped := 0
+	log.Println("Summary of canceled builds:")
+	for _, t := range running {
+		t.Status = statuses[t.BuildID]
+		if t.Status == string(cbtypes.StatusTypeStopped) {
+			stopped++
+		}
+		log.Printf("%s [%s]\n", t.BuildID, ColoredString(t.Status))
+	}
+	log.Printf("%d of %d build(s) stopped.\n", stopped, len(running))
+	return ctx.Err()
+}
+
+// log final status of tasks. retried builds are shown with build ids of all attempts and
+// batch builds with statuses of their builds.
+// failed builds are shown with their failed phases and lines returned by excerpt if it is not nil
+func LogSummary(tasks []*Task, excerpt func(t *Task) []string) {
+	log.Println("Summary:")
+	for _, t := range tasks {
+		ids := t.BuildIDs()
+		if len(ids) == 0 {
+			log.Printf("%s [%s]\n", t.Name(), ColoredString(t.Status))
+			continue
+		}
+		log.Printf("%s [%s] %s\n", t.Name(), ColoredString(t.Status), strings.Join(ids, " → "))
+		for _, c := range t.BatchChildren() {
+			log.Printf("    %s [%s] %s\n", c.Identifier, ColoredString(c.Status), c.BuildID)
+		}
+		if !t.Failed() || t.Info == nil {
+			continue
+		}
+		for _, p := range t.FailedPhases() {
+			log.Printf("    %s\n", PhaseMessage(p))
+		}
+		if excerpt != nil {
+			for _, line := range excerpt(t) {
+				log.Printf("    | %s\n", line)
+			}
+		}
+	}
+}
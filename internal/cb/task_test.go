@@ -0,0 +1,558 @@
+package cb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	cmt "github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestNewTasks(t *testing.T) {
+	tests := []struct {
+		name            string
+		builds          []cmt.Build
+		wantDeps        map[string][]string
+		wantErrContains string
+	}{
+		{
+			name: "resolve dependencies",
+			builds: []cmt.Build{
+				{RunnerOptions: cmt.RunnerOptions{ID: "infra"}, ProjectName: "proj-infra"},
+				{RunnerOptions: cmt.RunnerOptions{ID: "app", DependsOn: []string{"infra"}}, ProjectName: "proj-app"},
+				{ProjectName: "proj-other"},
+			},
+			wantDeps: map[string][]string{"infra": nil, "app": {"infra"}, "proj-other": nil},
+		},
+		{
+			name: "upstream is not in the builds to run",
+			builds: []cmt.Build{
+				{RunnerOptions: cmt.RunnerOptions{ID: "app", DependsOn: []string{"infra"}}, ProjectName: "proj-app"},
+			},
+			wantErrContains: "build 'app' depends on 'infra' which is not in the builds to run",
+		},
+		{
+			name: "duplicate id",
+			builds: []cmt.Build{
+				{RunnerOptions: cmt.RunnerOptions{ID: "app"}, ProjectName: "proj-app"},
+				{RunnerOptions: cmt.RunnerOptions{ID: "app"}, ProjectName: "proj-app2"},
+			},
+			wantErrContains: "duplicate build id 'app'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTasks([]BuildGroup{{Name: "group", Builds: tt.builds}})
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("NewTasks() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("NewTasks() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			gotDeps := make(map[string][]string)
+			for _, task := range got {
+				if task.Status != StatusPending {
+					t.Errorf("NewTasks() task %s status = %v, want %v", task.Name(), task.Status, StatusPending)
+				}
+				var deps []string
+				for _, d := range task.deps {
+					deps = append(deps, d.Name())
+				}
+				gotDeps[task.Name()] = deps
+			}
+			if !reflect.DeepEqual(gotDeps, tt.wantDeps) {
+				t.Errorf("NewTasks() deps = %v, want %v", gotDeps, tt.wantDeps)
+			}
+		})
+	}
+}
+
+// mock api which starts builds of project "<status>-xxx" ending with the status.
+// project "error-xxx" fails to start
+func newMockTaskAPI(started *[]string) *MockCodeBuildAPI {
+	var mu sync.Mutex
+	mock := NewMockCodeBuildAPI(
+		func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+			if strings.HasPrefix(*params.ProjectName, "error") {
+				return nil, errors.New("start build error")
+			}
+			mu.Lock()
+			*started = append(*started, *params.ProjectName)
+			mu.Unlock()
+			id := *params.ProjectName + ":12345678"
+			return &codebuild.StartBuildOutput{Build: &types.Build{Id: &id}}, nil
+		},
+		func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+			builds := make([]types.Build, len(params.Ids))
+			for i, id := range params.Ids {
+				status, _, _ := strings.Cut(id, "-")
+				builds[i] = types.Build{Id: &id, BuildStatus: types.StatusType(status)}
+			}
+			return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+		},
+		nil,
+	)
+	mock.StopBuildMock = func(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+		return &codebuild.StopBuildOutput{Build: &types.Build{Id: params.Id}}, nil
+	}
+	// FAILED builds succeed on retry and others end with the same status
+	mock.RetryBuildMock = func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error) {
+		id := strings.Replace(*params.Id, "FAILED", "SUCCEEDED", 1) + "-retry"
+		return &codebuild.RetryBuildOutput{Build: &types.Build{Id: &id}}, nil
+	}
+	return mock
+}
+
+func TestFollowTasks(t *testing.T) {
+	build := func(id, project string, deps ...string) cmt.Build {
+		return cmt.Build{RunnerOptions: cmt.RunnerOptions{ID: id, DependsOn: deps}, ProjectName: project}
+	}
+	tests := []struct {
+		name        string
+		builds      []cmt.Build
+		wantStarted []string
+		ordered     bool
+		opts        RunOptions
+		wantStatus  map[string]string
+		wantIDs     map[string][]string
+		wantFailed  bool
+	}{
+		{
+			name: "chain succeeded in order",
+			builds: []cmt.Build{
+				build("app", "SUCCEEDED-app", "migrate"),
+				build("migrate", "SUCCEEDED-migrate", "infra"),
+				build("infra", "SUCCEEDED-infra"),
+			},
+			wantStarted: []string{"SUCCEEDED-infra", "SUCCEEDED-migrate", "SUCCEEDED-app"},
+			ordered:     true,
+			wantStatus:  map[string]string{"infra": "SUCCEEDED", "migrate": "SUCCEEDED", "app": "SUCCEEDED"},
+			wantFailed:  false,
+		},
+		{
+			name: "dependents of failed build are skipped",
+			builds: []cmt.Build{
+				build("infra", "FAILED-infra"),
+				build("migrate", "SUCCEEDED-migrate", "infra"),
+				build("app", "SUCCEEDED-app", "migrate"),
+				build("other", "SUCCEEDED-other"),
+			},
+			wantStarted: []string{"FAILED-infra", "SUCCEEDED-other"},
+			wantStatus:  map[string]string{"infra": "FAILED", "migrate": StatusSkipped, "app": StatusSkipped, "other": "SUCCEEDED"},
+			wantFailed:  true,
+		},
+		{
+			name: "dependents of build failed to start are skipped",
+			builds: []cmt.Build{
+				build("infra", "error-infra"),
+				build("app", "SUCCEEDED-app", "infra"),
+			},
+			wantStarted: []string{},
+			wantStatus:  map[string]string{"infra": StatusFailedToStart, "app": StatusSkipped},
+			wantFailed:  true,
+		},
+		{
+			name: "fail fast stops other builds",
+			builds: []cmt.Build{
+				build("unit", "FAILED-unit"),
+				build("e2e", "IN_PROGRESS-e2e"),
+				build("deploy", "SUCCEEDED-deploy", "e2e"),
+			},
+			wantStarted: []string{"FAILED-unit", "IN_PROGRESS-e2e"},
+			opts:        RunOptions{FailFast: true},
+			wantStatus:  map[string]string{"unit": "FAILED", "e2e": StatusStopping, "deploy": StatusSkipped},
+			wantFailed:  true,
+		},
+		{
+			name: "failed build succeeds on retry",
+			builds: []cmt.Build{
+				build("flaky", "FAILED-flaky"),
+				build("deploy", "SUCCEEDED-deploy", "flaky"),
+			},
+			wantStarted: []string{"FAILED-flaky", "SUCCEEDED-deploy"},
+			opts:        RunOptions{Retries: 1},
+			wantStatus:  map[string]string{"flaky": "SUCCEEDED", "deploy": "SUCCEEDED"},
+			wantIDs: map[string][]string{
+				"flaky":  {"FAILED-flaky:12345678", "SUCCEEDED-flaky:12345678-retry"},
+				"deploy": {"SUCCEEDED-deploy:12345678"},
+			},
+			wantFailed: false,
+		},
+		{
+			name: "retries of build config override option",
+			builds: []cmt.Build{
+				{RunnerOptions: cmt.RunnerOptions{ID: "slow", Retries: 2}, ProjectName: "TIMED_OUT-slow"},
+				build("stopped", "STOPPED-stopped"),
+			},
+			wantStarted: []string{"TIMED_OUT-slow", "STOPPED-stopped"},
+			opts:        RunOptions{Retries: 1},
+			wantStatus:  map[string]string{"slow": "TIMED_OUT", "stopped": "STOPPED"},
+			wantIDs: map[string][]string{
+				"slow":    {"TIMED_OUT-slow:12345678", "TIMED_OUT-slow:12345678-retry", "TIMED_OUT-slow:12345678-retry-retry"},
+				"stopped": {"STOPPED-stopped:12345678"},
+			},
+			wantFailed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := []string{}
+			tasks, err := NewTasks([]BuildGroup{{Name: "group", Builds: tt.builds}})
+			if err != nil {
+				t.Fatalf("NewTasks() error = %v", err)
+			}
+			if err := FollowTasks(context.Background(), newMockTaskAPI(&started), tasks, tt.opts); err != nil {
+				t.Errorf("FollowTasks() error = %v", err)
+				return
+			}
+			// builds started at once can be in any order
+			if !tt.ordered {
+				slices.Sort(started)
+				slices.Sort(tt.wantStarted)
+			}
+			if !reflect.DeepEqual(started, tt.wantStarted) {
+				t.Errorf("FollowTasks() started = %v, want %v", started, tt.wantStarted)
+			}
+			gotStatus := make(map[string]string)
+			for _, task := range tasks {
+				gotStatus[task.Name()] = task.Status
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("FollowTasks() status = %v, want %v", gotStatus, tt.wantStatus)
+			}
+			if tt.wantIDs != nil {
+				gotIDs := make(map[string][]string)
+				for _, task := range tasks {
+					gotIDs[task.Name()] = task.BuildIDs()
+				}
+				if !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+					t.Errorf("FollowTasks() build ids = %v, want %v", gotIDs, tt.wantIDs)
+				}
+			}
+			if got := HasFailedTask(tasks); got != tt.wantFailed {
+				t.Errorf("HasFailedTask() = %v, want %v", got, tt.wantFailed)
+			}
+		})
+	}
+}
+
+func TestSplitTasksIntoStages(t *testing.T) {
+	build := func(id string, deps ...string) cmt.Build {
+		return cmt.Build{RunnerOptions: cmt.RunnerOptions{ID: id, DependsOn: deps}, ProjectName: "project-" + id}
+	}
+	tests := []struct {
+		name            string
+		groups          []BuildGroup
+		want            [][]string
+		wantErrContains string
+	}{
+		{
+			name: "one stage per group",
+			groups: []BuildGroup{
+				{Name: "infra", Builds: []cmt.Build{build("vpc"), build("db", "vpc")}},
+				{Name: "empty", Builds: []cmt.Build{}},
+				{Name: "app", Builds: []cmt.Build{build("api", "db"), build("web")}},
+			},
+			want: [][]string{{"vpc", "db"}, {"api", "web"}},
+		},
+		{
+			name: "depends on a later stage",
+			groups: []BuildGroup{
+				{Name: "app", Builds: []cmt.Build{build("api", "db")}},
+				{Name: "infra", Builds: []cmt.Build{build("db")}},
+			},
+			wantErrContains: "build 'api' in group 'app' depends on 'db' in later group 'infra'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tasks, err := NewTasks(tt.groups)
+			if err != nil {
+				t.Fatalf("NewTasks() error = %v", err)
+			}
+			got, err := SplitTasksIntoStages(tasks)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("SplitTasksIntoStages() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("SplitTasksIntoStages() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			gotNames := [][]string{}
+			for _, stage := range got {
+				names := []string{}
+				for _, task := range stage {
+					names = append(names, task.Name())
+				}
+				gotNames = append(gotNames, names)
+			}
+			if !reflect.DeepEqual(gotNames, tt.want) {
+				t.Errorf("SplitTasksIntoStages() = %v, want %v", gotNames, tt.want)
+			}
+		})
+	}
+}
+
+func TestFollowTasksCanceled(t *testing.T) {
+	tests := []struct {
+		name         string
+		stopOnCancel bool
+		wantStopped  []string
+		wantStatus   map[string]string
+	}{
+		{
+			name:         "stop in-progress builds",
+			stopOnCancel: true,
+			wantStopped:  []string{"app:12345678"},
+			wantStatus:   map[string]string{"app": "STOPPED", "web": StatusSkipped},
+		},
+		{
+			name:         "leave in-progress builds running",
+			stopOnCancel: false,
+			wantStopped:  []string{},
+			wantStatus:   map[string]string{"app": "IN_PROGRESS", "web": StatusSkipped},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stopped := []string{}
+			mock := NewMockCodeBuildAPI(
+				func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+					id := *params.ProjectName + ":12345678"
+					return &codebuild.StartBuildOutput{Build: &types.Build{Id: &id}}, nil
+				},
+				func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+					builds := make([]types.Build, len(params.Ids))
+					for i, id := range params.Ids {
+						status := types.StatusTypeInProgress
+						if slices.Contains(stopped, id) {
+							status = types.StatusTypeStopped
+						}
+						builds[i] = types.Build{Id: &id, BuildStatus: status}
+					}
+					return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+				},
+				nil,
+			)
+			mock.StopBuildMock = func(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+				stopped = append(stopped, *params.Id)
+				return &codebuild.StopBuildOutput{Build: &types.Build{Id: params.Id}}, nil
+			}
+			tasks, err := NewTasks([]BuildGroup{{Name: "group", Builds: []cmt.Build{
+				{RunnerOptions: cmt.RunnerOptions{ID: "app"}, ProjectName: "app"},
+				{RunnerOptions: cmt.RunnerOptions{ID: "web", DependsOn: []string{"app"}}, ProjectName: "web"},
+			}}})
+			if err != nil {
+				t.Fatalf("NewTasks() error = %v", err)
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			// cancel after the first build started
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				cancel()
+			}()
+			err = FollowTasks(ctx, mock, tasks, RunOptions{PollSec: 1, StopOnCancel: tt.stopOnCancel})
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("FollowTasks() error = %v, want %v", err, context.Canceled)
+			}
+			if !reflect.DeepEqual(stopped, tt.wantStopped) {
+				t.Errorf("FollowTasks() stopped = %v, want %v", stopped, tt.wantStopped)
+			}
+			gotStatus := make(map[string]string)
+			for _, task := range tasks {
+				gotStatus[task.Name()] = task.Status
+			}
+			if !reflect.DeepEqual(gotStatus, tt.wantStatus) {
+				t.Errorf("FollowTasks() status = %v, want %v", gotStatus, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestFollowTasksMaxParallel(t *testing.T) {
+	builds := func(names ...string) []cmt.Build {
+		b := []cmt.Build{}
+		for _, n := range names {
+			b = append(b, cmt.Build{ProjectName: n})
+		}
+		return b
+	}
+	tests := []struct {
+		name           string
+		groups         []BuildGroup
+		opts           RunOptions
+		wantMax        int
+		wantMaxByGroup map[string]int
+	}{
+		{
+			name: "unlimited",
+			groups: []BuildGroup{
+				{Name: "a", Builds: builds("a1", "a2", "a3")},
+				{Name: "b", Builds: builds("b1", "b2")},
+			},
+			opts:           RunOptions{},
+			wantMax:        5,
+			wantMaxByGroup: map[string]int{"a": 3, "b": 2},
+		},
+		{
+			name: "max parallel",
+			groups: []BuildGroup{
+				{Name: "a", Builds: builds("a1", "a2", "a3")},
+				{Name: "b", Builds: builds("b1", "b2")},
+			},
+			opts:           RunOptions{MaxParallel: 2},
+			wantMax:        2,
+			wantMaxByGroup: map[string]int{"a": 2, "b": 1},
+		},
+		{
+			name: "group max parallel",
+			groups: []BuildGroup{
+				{Name: "a", Builds: builds("a1", "a2", "a3")},
+				{Name: "b", Builds: builds("b1", "b2")},
+			},
+			opts:           RunOptions{GroupMaxParallel: map[string]int{"a": 1}},
+			wantMax:        3,
+			wantMaxByGroup: map[string]int{"a": 1, "b": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			running := map[string]int{}
+			gotMax := 0
+			gotMaxByGroup := map[string]int{}
+			mock := NewMockCodeBuildAPI(
+				func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+					mu.Lock()
+					defer mu.Unlock()
+					group := (*params.ProjectName)[:1]
+					running[group]++
+					gotMaxByGroup[group] = max(gotMaxByGroup[group], running[group])
+					total := 0
+					for _, n := range running {
+						total += n
+					}
+					gotMax = max(gotMax, total)
+					id := *params.ProjectName + ":12345678"
+					return &codebuild.StartBuildOutput{Build: &types.Build{Id: &id}}, nil
+				},
+				// every build ends at the first check
+				func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+					builds := make([]types.Build, len(params.Ids))
+					for i, id := range params.Ids {
+						running[id[:1]]--
+						builds[i] = types.Build{Id: &id, BuildStatus: types.StatusTypeSucceeded}
+					}
+					return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+				},
+				nil,
+			)
+			tasks, err := NewTasks(tt.groups)
+			if err != nil {
+				t.Fatalf("NewTasks() error = %v", err)
+			}
+			if err := FollowTasks(context.Background(), mock, tasks, tt.opts); err != nil {
+				t.Errorf("FollowTasks() error = %v", err)
+				return
+			}
+			if HasFailedTask(tasks) {
+				t.Errorf("HasFailedTask() = true, want false")
+			}
+			if gotMax != tt.wantMax {
+				t.Errorf("FollowTasks() max parallel = %v, want %v", gotMax, tt.wantMax)
+			}
+			if !reflect.DeepEqual(gotMaxByGroup, tt.wantMaxByGroup) {
+				t.Errorf("FollowTasks() max parallel by group = %v, want %v", gotMaxByGroup, tt.wantMaxByGroup)
+			}
+		})
+	}
+}
+
+func TestFollowTasksMaxParallelRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		opts RunOptions
+	}{
+		{name: "max parallel", opts: RunOptions{MaxParallel: 1, RetryBackoffSec: 1}},
+		{name: "group max parallel", opts: RunOptions{GroupMaxParallel: map[string]int{"a": 1}, RetryBackoffSec: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			started := map[string]time.Time{}
+			running, gotMax := 0, 0
+			inFlight := func(id string) {
+				started[id] = time.Now()
+				running++
+				gotMax = max(gotMax, running)
+			}
+			mock := newMockTaskAPI(&[]string{})
+			mock.StartBuildMock = func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				id := *params.ProjectName + ":12345678"
+				inFlight(id)
+				return &codebuild.StartBuildOutput{Build: &types.Build{Id: &id}}, nil
+			}
+			// FAILED builds end at the first check and succeed on retry.
+			// SUCCEEDED builds run longer than the retry backoff
+			mock.BatchGetBuildsMock = func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				builds := make([]types.Build, len(params.Ids))
+				for i, id := range params.Ids {
+					status, _, _ := strings.Cut(id, "-")
+					if status == "SUCCEEDED" && !strings.HasSuffix(id, "-retry") && time.Since(started[id]) < 1500*time.Millisecond {
+						status = "IN_PROGRESS"
+					} else {
+						running--
+					}
+					builds[i] = types.Build{Id: &id, BuildStatus: types.StatusType(status)}
+				}
+				return &codebuild.BatchGetBuildsOutput{Builds: builds}, nil
+			}
+			retry := mock.RetryBuildMock
+			mock.RetryBuildMock = func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error) {
+				out, err := retry(ctx, params, optFns...)
+				mu.Lock()
+				inFlight(*out.Build.Id)
+				mu.Unlock()
+				return out, err
+			}
+
+			tasks, err := NewTasks([]BuildGroup{{Name: "a", Builds: []cmt.Build{
+				{ProjectName: "FAILED-a1", RunnerOptions: cmt.RunnerOptions{Retries: 1}},
+				{ProjectName: "SUCCEEDED-a2"},
+			}}})
+			if err != nil {
+				t.Fatalf("NewTasks() error = %v", err)
+			}
+			if err := FollowTasks(context.Background(), mock, tasks, tt.opts); err != nil {
+				t.Fatalf("FollowTasks() error = %v", err)
+			}
+			if HasFailedTask(tasks) {
+				t.Errorf("HasFailedTask() = true, want false")
+			}
+			if len(tasks[0].Attempts) != 1 {
+				t.Errorf("FollowTasks() attempts = %v, want 1 attempt", tasks[0].Attempts)
+			}
+			if gotMax != 1 {
+				t.Errorf("FollowTasks() max builds in flight = %v, want 1", gotMax)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package cb
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/goccy/go-yaml/ast"
+)
+
+// yaml of a config file, used to report positions of errors
+type configSource struct {
+	name string
+	file *ast.File
+}
+
+// return "file:line:column" of the node at the path of keys (string) and indexes (int),
+// or the file name when the node is not found
+func (s configSource) position(keys ...any) string {
+	if s.file == nil {
+		return s.name
+	}
+	b := (&yaml.PathBuilder{}).Root()
+	for _, k := range keys {
+		switch k := k.(type) {
+		case string:
+			b = b.Child(k)
+		case int:
+			b = b.Index(uint(k))
+		}
+	}
+	node, err := b.Build().FilterFile(s.file)
+	if err != nil || node == nil {
+		return s.name
+	}
+	pos := node.GetToken().Position
+	return fmt.Sprintf("%s:%d:%d", s.name, pos.Line, pos.Column)
+}
+
+// name of a template in extends with the position where it is referred.
+// positions are taken when each file is read as entries move by merging files
+type templateRef struct {
+	name string
+	pos  string
+}
+
+// replace names in extends of build entries and templates of config data read from src with templateRef
+func locateTemplateRefs(data map[string]any, src configSource) error {
+	if v, ok := data["templates"]; ok {
+		templates, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: `templates` field must be a map of template names to build fields", src.position("templates"))
+		}
+		for name, t := range templates {
+			m, ok := t.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: template '%s' must be a map of build fields", src.position("templates", name), name)
+			}
+			if err := locateExtends(m, src, []any{"templates", name}); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch builds := data["builds"].(type) {
+	case map[string]any:
+		for group, entries := range builds {
+			list, _ := entries.([]any)
+			for i, e := range list {
+				if entry, ok := e.(map[string]any); ok {
+					if err := locateExtends(entry, src, []any{"builds", group, i}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	case []any:
+		for i, e := range builds {
+			if entry, ok := e.(map[string]any); ok {
+				if err := locateExtends(entry, src, []any{"builds", i}); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// replace names in extends of entry at path with templateRef
+func locateExtends(entry map[string]any, src configSource, path []any) error {
+	v, ok := entry["extends"]
+	if !ok {
+		return nil
+	}
+	names, ok := v.([]any)
+	if !ok {
+		return fmt.Errorf("%s: extends must be a list of template names", src.position(append(path, "extends")...))
+	}
+	for j, n := range names {
+		refPath := append(slices.Clone(path), "extends", j)
+		name, ok := n.(string)
+		if !ok {
+			return fmt.Errorf("%s: extends must be a list of template names", src.position(refPath...))
+		}
+		names[j] = templateRef{name: name, pos: src.position(refPath...)}
+	}
+	return nil
+}
+
+// resolve extends of build entries with templates of config data and remove templates from it.
+// templates are layered in the order of extends and fields of entries win over them
+func applyTemplates(data map[string]any) error {
+	r := templateResolver{templates: map[string]map[string]any{}, resolved: map[string]map[string]any{}}
+	if v, ok := data["templates"]; ok {
+		delete(data, "templates")
+		// checked by locateTemplateRefs
+		for name, t := range v.(map[string]any) {
+			r.templates[name] = t.(map[string]any)
+		}
+	}
+
+	switch builds := data["builds"].(type) {
+	case map[string]any:
+		for _, entries := range builds {
+			list, ok := entries.([]any)
+			if !ok {
+				continue
+			}
+			for i, e := range list {
+				if entry, ok := e.(map[string]any); ok {
+					extended, err := r.extend(entry, nil)
+					if err != nil {
+						return err
+					}
+					list[i] = extended
+				}
+			}
+		}
+	case []any:
+		for i, e := range builds {
+			if entry, ok := e.(map[string]any); ok {
+				extended, err := r.extend(entry, nil)
+				if err != nil {
+					return err
+				}
+				builds[i] = extended
+			}
+		}
+	}
+	return nil
+}
+
+type templateResolver struct {
+	templates map[string]map[string]any
+	resolved  map[string]map[string]any
+}
+
+// return entry merged into templates of its extends.
+// stack is names of templates being resolved to detect cycles
+func (r *templateResolver) extend(entry map[string]any, stack []string) (map[string]any, error) {
+	v, ok := entry["extends"]
+	if !ok {
+		return entry, nil
+	}
+	base := map[string]any{}
+	for _, n := range v.([]any) {
+		ref, ok := n.(templateRef)
+		if !ok {
+			return nil, fmt.Errorf("extends must be a list of template names")
+		}
+		t, err := r.resolve(ref, stack)
+		if err != nil {
+			return nil, err
+		}
+		base = mergeValues(base, t).(map[string]any)
+	}
+	own := copyValue(entry).(map[string]any)
+	delete(own, "extends")
+	return mergeValues(base, own).(map[string]any), nil
+}
+
+// return template referred by ref with its extends resolved
+func (r *templateResolver) resolve(ref templateRef, stack []string) (map[string]any, error) {
+	if t, ok := r.resolved[ref.name]; ok {
+		return t, nil
+	}
+	if slices.Contains(stack, ref.name) {
+		return nil, fmt.Errorf("%s: template cycle: %s", ref.pos, strings.Join(append(stack, ref.name), " -> "))
+	}
+	t, ok := r.templates[ref.name]
+	if !ok {
+		return nil, fmt.Errorf("%s: unknown template '%s'", ref.pos, ref.name)
+	}
+	resolved, err := r.extend(t, append(slices.Clone(stack), ref.name))
+	if err != nil {
+		return nil, err
+	}
+	r.resolved[ref.name] = resolved
+	return resolved, nil
+}
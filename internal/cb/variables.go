@@ -0,0 +1,132 @@
+package cb
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/goccy/go-yaml/lexer"
+	"github.com/goccy/go-yaml/token"
+)
+
+// references to environment variables in config files. $$ is an escaped $
+var (
+	variableReference = regexp.MustCompile(`\$\$|\$\{([^}]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+	variableName      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// expand environment variables in yaml of the config file name.
+// ${VAR:-default} is replaced with default when VAR is unset or empty, ${VAR:?message} is an error when VAR is unset or empty,
+// and $$ is replaced with $. references to unset variables without defaults are errors,
+// which are reported all together with line numbers. comments of yaml are not expanded
+func expandVariables(name string, content string) (string, error) {
+	comments := commentColumns(content)
+	lines := strings.Split(content, "\n")
+	var errs []string
+	for i, line := range lines {
+		code, comment := line, ""
+		if col, ok := comments[i+1]; ok {
+			cut := columnIndex(line, col)
+			code, comment = line[:cut], line[cut:]
+		}
+		lines[i] = variableReference.ReplaceAllStringFunc(code, func(ref string) string {
+			value, err := expandVariable(ref)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("  line %d: %v", i+1, err))
+			}
+			return value
+		}) + comment
+		// a reference whose default or message contains " #" is cut by the comment
+		if j := unclosedReference(code); comment != "" && j >= 0 {
+			ref, _, _ := strings.Cut(line[j:], "}")
+			errs = append(errs, fmt.Sprintf("  line %d: invalid variable reference '%s}'", i+1, ref))
+		}
+	}
+	if len(errs) > 0 {
+		return "", fmt.Errorf("failed to expand environment variables in %s:\n%s", name, strings.Join(errs, "\n"))
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// return columns where comments start keyed by line numbers, found by the yaml lexer
+// so that # in quoted strings and block scalars is not taken as a comment
+func commentColumns(content string) map[int]int {
+	columns := map[int]int{}
+	for _, tk := range lexer.Tokenize(content) {
+		if tk.Type == token.CommentType {
+			columns[tk.Position.Line] = tk.Position.Column
+		}
+	}
+	return columns
+}
+
+// return index of ${ in code which is not closed, or -1
+func unclosedReference(code string) int {
+	start := 0
+	for _, m := range variableReference.FindAllStringIndex(code, -1) {
+		if i := strings.Index(code[start:m[0]], "${"); i >= 0 {
+			return start + i
+		}
+		start = m[1]
+	}
+	if i := strings.Index(code[start:], "${"); i >= 0 {
+		return start + i
+	}
+	return -1
+}
+
+// return byte index of the column (counted in characters from 1) of line
+func columnIndex(line string, column int) int {
+	n := 1
+	for i := range line {
+		if n == column {
+			return i
+		}
+		n++
+	}
+	return len(line)
+}
+
+// return value of a reference to an environment variable
+func expandVariable(ref string) (string, error) {
+	if ref == "$$" {
+		return "$", nil
+	}
+	m := variableReference.FindStringSubmatch(ref)
+	if m[2] != "" {
+		value, ok := os.LookupEnv(m[2])
+		if !ok {
+			return "", fmt.Errorf("variable '%s' is not set", m[2])
+		}
+		return value, nil
+	}
+
+	name, rest := m[1], ""
+	if i := strings.Index(m[1], ":"); i >= 0 {
+		name, rest = m[1][:i], m[1][i:]
+	}
+	if !variableName.MatchString(name) {
+		return "", fmt.Errorf("invalid variable reference '%s'", ref)
+	}
+	value, ok := os.LookupEnv(name)
+	switch {
+	case strings.HasPrefix(rest, ":-"):
+		if value == "" {
+			return rest[2:], nil
+		}
+	case strings.HasPrefix(rest, ":?"):
+		if value == "" {
+			message := rest[2:]
+			if message == "" {
+				message = "is not set"
+			}
+			return "", fmt.Errorf("%s: %s", name, message)
+		}
+	case rest != "":
+		return "", fmt.Errorf("invalid variable reference '%s'", ref)
+	case !ok:
+		return "", fmt.Errorf("variable '%s' is not set", name)
+	}
+	return value, nil
+}
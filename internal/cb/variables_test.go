@@ -0,0 +1,86 @@
+package cb
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_expandVariables(t *testing.T) {
+	t.Setenv("TEST_BRANCH", "feature/a")
+	t.Setenv("TEST_EMPTY", "")
+	tests := []struct {
+		name            string
+		content         string
+		want            string
+		wantErrContains string
+	}{
+		{
+			name:    "set variables",
+			content: "a: ${TEST_BRANCH}\nb: $TEST_BRANCH\nc: '${TEST_EMPTY}'",
+			want:    "a: feature/a\nb: feature/a\nc: ''",
+		},
+		{
+			name:    "defaults",
+			content: "a: ${TEST_BRANCH:-main}\nb: ${TEST_UNSET:-main}\nc: ${TEST_EMPTY:-main}",
+			want:    "a: feature/a\nb: main\nc: main",
+		},
+		{
+			name:    "escape and comments",
+			content: "# ${TEST_UNSET}\na: $${TEST_UNSET} $$1",
+			want:    "# ${TEST_UNSET}\na: ${TEST_UNSET} $1",
+		},
+		{
+			name:    "trailing comments",
+			content: "a: ${TEST_BRANCH} # ${TEST_UNSET}\nb: 'x # ${TEST_BRANCH}' # ${TEST_UNSET}\nc: ${TEST_UNSET:-x#y}",
+			want:    "a: feature/a # ${TEST_UNSET}\nb: 'x # feature/a' # ${TEST_UNSET}\nc: x#y",
+		},
+		{
+			name:    "block scalars",
+			content: "buildspecOverride: |\n  # ${TEST_BRANCH}\n  echo ${TEST_BRANCH}\nb: ok",
+			want:    "buildspecOverride: |\n  # feature/a\n  echo feature/a\nb: ok",
+		},
+		{
+			name:            "unset variable in block scalars",
+			content:         "buildspecOverride: |\n  # ${TEST_UNSET}\nb: ok",
+			wantErrContains: "  line 2: variable 'TEST_UNSET' is not set",
+		},
+		{
+			name:            "reference cut by a comment",
+			content:         "a: ${TEST_BRANCH:-x # y}\nb: $${TEST_UNSET # ${TEST_UNSET}\nc: ${TEST_UNSET:-x} $TEST_BRANCH ${TEST_UNSET:?x # y} # z",
+			wantErrContains: "  line 1: invalid variable reference '${TEST_BRANCH:-x # y}'\n  line 3: invalid variable reference '${TEST_UNSET:?x # y}'",
+		},
+		{
+			name:            "required",
+			content:         "a: ${TEST_BRANCH:?branch is required}\nb: ${TEST_EMPTY:?branch is required}",
+			wantErrContains: "failed to expand environment variables in config.yaml:\n  line 2: TEST_EMPTY: branch is required",
+		},
+		{
+			name:            "all unset variables",
+			content:         "a: ${TEST_UNSET}\nb: ok\nc: $TEST_UNSET2 ${TEST_UNSET3:?}",
+			wantErrContains: "  line 1: variable 'TEST_UNSET' is not set\n  line 3: variable 'TEST_UNSET2' is not set\n  line 3: TEST_UNSET3: is not set",
+		},
+		{
+			name:            "invalid reference",
+			content:         "a: ${TEST BRANCH}\nb: ${TEST_BRANCH-main}",
+			wantErrContains: "  line 1: invalid variable reference '${TEST BRANCH}'\n  line 2: invalid variable reference '${TEST_BRANCH-main}'",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandVariables("config.yaml", tt.content)
+			if (err != nil) != (tt.wantErrContains != "") {
+				t.Errorf("expandVariables() error = %v, wantErr %v", err, tt.wantErrContains != "")
+				return
+			}
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.wantErrContains) {
+					t.Errorf("expandVariables() error = %v, wantErr containing %q", err, tt.wantErrContains)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("expandVariables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
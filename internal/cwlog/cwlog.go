@@ -4,13 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
 	"github.com/koh-sh/codebuild-multirunner/internal/cb"
 )
 
+var (
+	// ErrCloudWatchLogsDisabled is returned if CloudWatch Logs are disabled for a build
+	ErrCloudWatchLogsDisabled = errors.New("CloudWatch Logs is Disabled")
+	errLogNotAvailable        = errors.New("CloudWatch Logs stream is not available yet")
+)
+
 // interface for AWS CloudWatch Logs API
 type CWLGetLogEventsAPI interface {
 	GetLogEvents(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error)
@@ -27,19 +38,37 @@ func NewCloudWatchLogsAPI() (CWLGetLogEventsAPI, error) {
 
 // get CloudWatch Log settings from a build and return logGroupName, logStreamName and error
 func GetCloudWatchLogSetting(client cb.CodeBuildAPI, id string) (string, string, error) {
+	build, err := getBuild(client, id)
+	if err != nil {
+		return "", "", err
+	}
+	return CloudWatchLogSetting(id, build)
+}
+
+// get a build with BatchGetBuilds
+func getBuild(client cb.CodeBuildAPI, id string) (cbtypes.Build, error) {
 	input := codebuild.BatchGetBuildsInput{Ids: []string{id}}
 	result, err := client.BatchGetBuilds(context.Background(), &input)
 	if err != nil {
-		return "", "", err
+		return cbtypes.Build{}, err
 	}
 	if len(result.Builds) == 0 {
-		return "", "", fmt.Errorf("%v is not found", id)
+		return cbtypes.Build{}, fmt.Errorf("%v is not found", id)
 	}
-	build := result.Builds[0].Logs
-	if build.CloudWatchLogs.Status == "DISABLED" {
-		return "", "", fmt.Errorf("CloudWatch Logs for %v is Disabled", id)
+	return result.Builds[0], nil
+}
+
+// return logGroupName and logStreamName of a build.
+// errLogNotAvailable is returned if the log stream is not created yet
+func CloudWatchLogSetting(id string, build cbtypes.Build) (string, string, error) {
+	logs := build.Logs
+	if logs != nil && logs.CloudWatchLogs != nil && logs.CloudWatchLogs.Status == cbtypes.LogsConfigStatusTypeDisabled {
+		return "", "", fmt.Errorf("%w for %v", ErrCloudWatchLogsDisabled, id)
 	}
-	return *build.GroupName, *build.StreamName, nil
+	if logs == nil || logs.GroupName == nil || logs.StreamName == nil {
+		return "", "", fmt.Errorf("%w for %v", errLogNotAvailable, id)
+	}
+	return *logs.GroupName, *logs.StreamName, nil
 }
 
 // get CloudWatchLog events and return GetLogEventsOutput
@@ -62,3 +91,93 @@ func GetCloudWatchLogEvents(client CWLGetLogEventsAPI, group string, stream stri
 	}
 	return *result, nil
 }
+
+// return the last lines of a log stream
+func GetLastCloudWatchLogLines(client CWLGetLogEventsAPI, group string, stream string, lines int) ([]string, error) {
+	startfromhead := false
+	limit := int32(lines)
+	input := &cloudwatchlogs.GetLogEventsInput{
+		LogGroupName:  &group,
+		LogStreamName: &stream,
+		StartFromHead: &startfromhead,
+		Limit:         &limit,
+	}
+	result, err := client.GetLogEvents(context.Background(), input)
+	if err != nil {
+		return nil, err
+	}
+	// events are in chronological order and a message can have multiple lines
+	var text strings.Builder
+	for _, event := range result.Events {
+		text.WriteString(*event.Message)
+	}
+	all := strings.Split(strings.TrimRight(text.String(), "\n"), "\n")
+	if len(all) == 1 && all[0] == "" {
+		return nil, nil
+	}
+	return all[max(len(all)-lines, 0):], nil
+}
+
+// return the last lines of the log of a failed build of a task. nil is returned if the log is not available
+func FailureExcerpt(client CWLGetLogEventsAPI, t *cb.Task, lines int) []string {
+	if lines <= 0 || t.Info == nil {
+		return nil
+	}
+	group, stream, err := CloudWatchLogSetting(t.BuildID, *t.Info)
+	if err != nil {
+		return nil
+	}
+	excerpt, err := GetLastCloudWatchLogLines(client, group, stream, lines)
+	if err != nil {
+		log.Printf("failed to get log of %s: %v\n", t.BuildID, err)
+		return nil
+	}
+	return excerpt
+}
+
+// print log events from token to the end of the stream and return the token for the next events
+func PrintCloudWatchLogEvents(client CWLGetLogEventsAPI, group string, stream string, token string, out io.Writer) (string, error) {
+	for {
+		res, err := GetCloudWatchLogEvents(client, group, stream, token)
+		if err != nil {
+			return token, err
+		}
+		// NextForwardToken is..
+		// The token for the next set of items in the forward direction. The token expires
+		// after 24 hours. If you have reached the end of the stream, it returns the same
+		// token you passed in.
+		if res.NextForwardToken == nil || *res.NextForwardToken == token {
+			return token, nil
+		}
+		token = *res.NextForwardToken
+		for _, event := range res.Events {
+			fmt.Fprint(out, *event.Message)
+		}
+	}
+}
+
+// print log events of a build until the build ends and return the final status of the build
+func FollowCloudWatchLog(cbclient cb.CodeBuildAPI, client CWLGetLogEventsAPI, id string, out io.Writer, interval time.Duration) (string, error) {
+	token := ""
+	for {
+		// check status before reading events so that all events are read after the build ended
+		build, err := getBuild(cbclient, id)
+		if err != nil {
+			return "", err
+		}
+		group, stream, err := CloudWatchLogSetting(id, build)
+		switch {
+		case err == nil:
+			token, err = PrintCloudWatchLogEvents(client, group, stream, token, out)
+			if err != nil {
+				return "", err
+			}
+		case !errors.Is(err, errLogNotAvailable):
+			return "", err
+		}
+		if build.BuildStatus != cbtypes.StatusTypeInProgress {
+			return string(build.BuildStatus), nil
+		}
+		time.Sleep(interval)
+	}
+}
@@ -1,10 +1,14 @@
 package cwlog
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
@@ -14,9 +18,16 @@ import (
 )
 
 type MockCodeBuildAPI struct {
-	StartBuildMock     func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
-	BatchGetBuildsMock func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
-	RetryBuildMock     func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error)
+	StartBuildMock                 func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error)
+	BatchGetBuildsMock             func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error)
+	RetryBuildMock                 func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error)
+	StopBuildMock                  func(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error)
+	ListBuildsForProjectMock       func(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error)
+	StartBuildBatchMock            func(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error)
+	BatchGetBuildBatchesMock       func(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error)
+	RetryBuildBatchMock            func(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error)
+	StopBuildBatchMock             func(ctx context.Context, params *codebuild.StopBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildBatchOutput, error)
+	ListBuildBatchesForProjectMock func(ctx context.Context, params *codebuild.ListBuildBatchesForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildBatchesForProjectOutput, error)
 }
 
 func (m *MockCodeBuildAPI) StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
@@ -31,6 +42,34 @@ func (m *MockCodeBuildAPI) RetryBuild(ctx context.Context, params *codebuild.Ret
 	return m.RetryBuildMock(ctx, params, optFns...)
 }
 
+func (m *MockCodeBuildAPI) StopBuild(ctx context.Context, params *codebuild.StopBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildOutput, error) {
+	return m.StopBuildMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) ListBuildsForProject(ctx context.Context, params *codebuild.ListBuildsForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildsForProjectOutput, error) {
+	return m.ListBuildsForProjectMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) StartBuildBatch(ctx context.Context, params *codebuild.StartBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildBatchOutput, error) {
+	return m.StartBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) BatchGetBuildBatches(ctx context.Context, params *codebuild.BatchGetBuildBatchesInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildBatchesOutput, error) {
+	return m.BatchGetBuildBatchesMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) RetryBuildBatch(ctx context.Context, params *codebuild.RetryBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildBatchOutput, error) {
+	return m.RetryBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) StopBuildBatch(ctx context.Context, params *codebuild.StopBuildBatchInput, optFns ...func(*codebuild.Options)) (*codebuild.StopBuildBatchOutput, error) {
+	return m.StopBuildBatchMock(ctx, params, optFns...)
+}
+
+func (m *MockCodeBuildAPI) ListBuildBatchesForProject(ctx context.Context, params *codebuild.ListBuildBatchesForProjectInput, optFns ...func(*codebuild.Options)) (*codebuild.ListBuildBatchesForProjectOutput, error) {
+	return m.ListBuildBatchesForProjectMock(ctx, params, optFns...)
+}
+
 func NewMockCodeBuildAPI(startBuildMock func(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error),
 	batchGetBuildsMock func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error),
 	retryBuildMock func(ctx context.Context, params *codebuild.RetryBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.RetryBuildOutput, error),
@@ -257,3 +296,108 @@ func TestGetCloudWatchLogEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestFollowCloudWatchLog(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []types.StatusType
+		wantOut    string
+		wantStatus string
+		wantErr    bool
+	}{
+		{
+			name:       "follow until succeeded",
+			statuses:   []types.StatusType{types.StatusTypeInProgress, types.StatusTypeInProgress, types.StatusTypeSucceeded},
+			wantOut:    "line1\nline2\nline3\n",
+			wantStatus: "SUCCEEDED",
+		},
+		{
+			name:       "build already failed",
+			statuses:   []types.StatusType{types.StatusTypeFailed},
+			wantOut:    "line1\n",
+			wantStatus: "FAILED",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// a line is appended to the log on each status check
+			checks := 0
+			cbclient := NewMockCodeBuildAPI(
+				nil,
+				func(ctx context.Context, params *codebuild.BatchGetBuildsInput, optFns ...func(*codebuild.Options)) (*codebuild.BatchGetBuildsOutput, error) {
+					status := tt.statuses[min(checks, len(tt.statuses)-1)]
+					checks++
+					return &codebuild.BatchGetBuildsOutput{Builds: []types.Build{{
+						BuildStatus: status,
+						Logs: &types.LogsLocation{
+							CloudWatchLogs: &types.CloudWatchLogsConfig{Status: "ENABLED"},
+							GroupName:      aws.String("/aws/codebuild/project"),
+							StreamName:     aws.String("12345678"),
+						},
+					}}}, nil
+				},
+				nil,
+			)
+			cwlclient := NewMockCWLGetLogEventsAPI(
+				func(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+					read := 0
+					if params.NextToken != nil {
+						read, _ = strconv.Atoi(*params.NextToken)
+					}
+					var events []cwltypes.OutputLogEvent
+					for i := read + 1; i <= checks; i++ {
+						events = append(events, cwltypes.OutputLogEvent{Message: aws.String(fmt.Sprintf("line%d\n", i))})
+					}
+					return &cloudwatchlogs.GetLogEventsOutput{Events: events, NextForwardToken: aws.String(strconv.Itoa(checks))}, nil
+				},
+			)
+			var out bytes.Buffer
+			got, err := FollowCloudWatchLog(cbclient, cwlclient, "project:12345678", &out, time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("FollowCloudWatchLog() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.wantStatus {
+				t.Errorf("FollowCloudWatchLog() = %v, want %v", got, tt.wantStatus)
+			}
+			if out.String() != tt.wantOut {
+				t.Errorf("FollowCloudWatchLog() output = %q, want %q", out.String(), tt.wantOut)
+			}
+		})
+	}
+}
+
+func TestGetLastCloudWatchLogLines(t *testing.T) {
+	mockCWLGetLogEventsAPI := NewMockCWLGetLogEventsAPI(
+		func(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+			if *params.StartFromHead {
+				return nil, errors.New("StartFromHead must be false")
+			}
+			all := []string{"line1\n", "line2\nline3\n", "line4\n"}
+			var events []cwltypes.OutputLogEvent
+			for _, m := range all[max(len(all)-int(*params.Limit), 0):] {
+				events = append(events, cwltypes.OutputLogEvent{Message: aws.String(m)})
+			}
+			return &cloudwatchlogs.GetLogEventsOutput{Events: events}, nil
+		},
+	)
+	tests := []struct {
+		name  string
+		lines int
+		want  []string
+	}{
+		{name: "last 2 lines", lines: 2, want: []string{"line3", "line4"}},
+		{name: "more lines than the log", lines: 10, want: []string{"line1", "line2", "line3", "line4"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetLastCloudWatchLogLines(mockCWLGetLogEventsAPI, "/aws/codebuild/project", "12345678", tt.lines)
+			if err != nil {
+				t.Fatalf("GetLastCloudWatchLogLines() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetLastCloudWatchLogLines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package cwlog
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+// interval to read new log events of running builds
+const FollowInterval = 5 * time.Second
+
+// colors of prefixes, assigned to builds in turn
+var prefixColors = []color.Attribute{color.FgCyan, color.FgMagenta, color.FgGreen, color.FgYellow, color.FgBlue, color.FgHiCyan, color.FgHiMagenta, color.FgHiGreen}
+
+// LogFollower prints CloudWatch logs of running builds with a [group/project] prefix on each line
+type LogFollower struct {
+	client CWLGetLogEventsAPI
+	out    io.Writer
+	mu     sync.Mutex
+	// log streams being read in the order of registration
+	streams []*logStream
+	// log streams by build id. nil for builds without CloudWatch Logs
+	byID   map[string]*logStream
+	colors map[string]*color.Color
+}
+
+// cursor of a log stream of a build
+type logStream struct {
+	prefix string
+	group  string
+	stream string
+	token  string
+	// incomplete last line of the read events
+	partial string
+	// build ended and remaining events are read on the next poll
+	ended bool
+}
+
+// return LogFollower which writes logs to out
+func NewLogFollower(client CWLGetLogEventsAPI, out io.Writer) *LogFollower {
+	return &LogFollower{client: client, out: out, byID: make(map[string]*logStream), colors: make(map[string]*color.Color)}
+}
+
+// register log streams of builds of tasks and mark ended ones.
+// it is used as OnUpdate of cb.RunOptions
+func (f *LogFollower) Update(tasks []*cb.Task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range tasks {
+		if t.Info == nil {
+			continue
+		}
+		s, ok := f.byID[t.BuildID]
+		if !ok {
+			group, stream, err := CloudWatchLogSetting(t.BuildID, *t.Info)
+			if errors.Is(err, errLogNotAvailable) {
+				continue
+			}
+			if err != nil {
+				log.Println(err)
+			} else {
+				s = &logStream{prefix: f.prefix(t), group: group, stream: stream}
+				f.streams = append(f.streams, s)
+			}
+			f.byID[t.BuildID] = s
+		}
+		// the build of a retrying task will not write logs anymore
+		if s != nil && (t.Ended() || t.Status == cb.StatusRetrying) {
+			s.ended = true
+		}
+	}
+}
+
+// return colored prefix of a task. retries of a build share the same color
+func (f *LogFollower) prefix(t *cb.Task) string {
+	name := t.Build.ProjectName
+	if name == "" && t.Info.ProjectName != nil {
+		name = *t.Info.ProjectName
+	}
+	if t.Group != "" {
+		name = t.Group + "/" + name
+	}
+	c, ok := f.colors[name]
+	if !ok {
+		c = color.New(prefixColors[len(f.colors)%len(prefixColors)])
+		f.colors[name] = c
+	}
+	return c.Sprintf("[%s]", name)
+}
+
+// print new log events of registered builds and forget builds which ended
+func (f *LogFollower) Poll() {
+	f.mu.Lock()
+	streams := make([]*logStream, len(f.streams))
+	copy(streams, f.streams)
+	ended := make(map[*logStream]bool, len(streams))
+	for _, s := range streams {
+		ended[s] = s.ended
+	}
+	f.mu.Unlock()
+
+	done := map[*logStream]bool{}
+	for _, s := range streams {
+		if err := f.read(s); err != nil {
+			log.Printf("failed to get logs of %s: %v\n", s.prefix, err)
+			continue
+		}
+		if ended[s] {
+			if s.partial != "" {
+				fmt.Fprintf(f.out, "%s %s\n", s.prefix, s.partial)
+			}
+			done[s] = true
+		}
+	}
+
+	f.mu.Lock()
+	remaining := f.streams[:0]
+	for _, s := range f.streams {
+		if !done[s] {
+			remaining = append(remaining, s)
+		}
+	}
+	f.streams = remaining
+	f.mu.Unlock()
+}
+
+// read log events of a stream from its cursor to the end and print complete lines
+func (f *LogFollower) read(s *logStream) error {
+	for {
+		res, err := GetCloudWatchLogEvents(f.client, s.group, s.stream, s.token)
+		if err != nil {
+			return err
+		}
+		for _, event := range res.Events {
+			lines := strings.Split(s.partial+*event.Message, "\n")
+			s.partial = lines[len(lines)-1]
+			for _, line := range lines[:len(lines)-1] {
+				fmt.Fprintf(f.out, "%s %s\n", s.prefix, line)
+			}
+		}
+		// same token is returned at the end of the stream
+		if res.NextForwardToken == nil || *res.NextForwardToken == s.token {
+			return nil
+		}
+		s.token = *res.NextForwardToken
+	}
+}
+
+// print log events every interval in background.
+// returned function stops it after printing remaining events
+func (f *LogFollower) Start(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				f.Poll()
+				return
+			case <-ticker.C:
+				f.Poll()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
@@ -0,0 +1,81 @@
+package cwlog
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cwltypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/fatih/color"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	cmt "github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestLogFollower(t *testing.T) {
+	color.NoColor = true
+	// pages of log events by stream name and token
+	pages := map[string]map[string][]string{
+		"stream-a": {"": {"line1\n", "line2 part"}, "1": {"ial\n"}},
+		"stream-b": {"": {"b1\n"}},
+	}
+	calls := 0
+	client := NewMockCWLGetLogEventsAPI(
+		func(ctx context.Context, params *cloudwatchlogs.GetLogEventsInput, optFns ...func(*cloudwatchlogs.Options)) (*cloudwatchlogs.GetLogEventsOutput, error) {
+			calls++
+			token := ""
+			if params.NextToken != nil {
+				token = *params.NextToken
+			}
+			var events []cwltypes.OutputLogEvent
+			for _, m := range pages[*params.LogStreamName][token] {
+				events = append(events, cwltypes.OutputLogEvent{Message: aws.String(m)})
+			}
+			// the token advances only if there are events
+			next := token
+			if len(events) > 0 {
+				next += "1"
+			}
+			return &cloudwatchlogs.GetLogEventsOutput{Events: events, NextForwardToken: aws.String(next)}, nil
+		},
+	)
+	newInfo := func(stream string, status types.LogsConfigStatusType) *types.Build {
+		return &types.Build{Logs: &types.LogsLocation{
+			CloudWatchLogs: &types.CloudWatchLogsConfig{Status: status},
+			GroupName:      aws.String("/aws/codebuild/proj"),
+			StreamName:     aws.String(stream),
+		}}
+	}
+	tasks := []*cb.Task{
+		{Group: "g1", Build: cmt.Build{ProjectName: "proj-a"}, BuildID: "a:1", Status: "IN_PROGRESS", Info: newInfo("stream-a", types.LogsConfigStatusTypeEnabled)},
+		// log stream is not created yet
+		{Group: "g2", Build: cmt.Build{ProjectName: "proj-b"}, BuildID: "b:1", Status: "IN_PROGRESS", Info: &types.Build{}},
+		{Group: "g2", Build: cmt.Build{ProjectName: "proj-c"}, BuildID: "c:1", Status: "IN_PROGRESS", Info: newInfo("stream-c", types.LogsConfigStatusTypeDisabled)},
+	}
+
+	var out bytes.Buffer
+	f := NewLogFollower(client, &out)
+	f.Update(tasks)
+	f.Poll()
+	if got, want := out.String(), "[g1/proj-a] line1\n[g1/proj-a] line2 partial\n"; got != want {
+		t.Errorf("LogFollower output = %q, want %q", got, want)
+	}
+
+	out.Reset()
+	tasks[0].Status = "SUCCEEDED"
+	tasks[1].Info = newInfo("stream-b", types.LogsConfigStatusTypeEnabled)
+	f.Update(tasks)
+	f.Poll()
+	if got, want := out.String(), "[g2/proj-b] b1\n"; got != want {
+		t.Errorf("LogFollower output = %q, want %q", got, want)
+	}
+
+	// ended build is not read anymore
+	calls = 0
+	f.Poll()
+	if calls != 1 {
+		t.Errorf("LogFollower GetLogEvents calls = %d, want %d", calls, 1)
+	}
+}
@@ -0,0 +1,294 @@
+package dashboard
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"golang.org/x/term"
+)
+
+// interval to redraw the dashboard for elapsed time
+const RefreshInterval = time.Second
+
+// width of the progress bar
+const barWidth = 30
+
+// Dashboard renders a live-updating table of builds in a run to a terminal
+type Dashboard struct {
+	out io.Writer
+	mu  sync.Mutex
+	// rows in the order of registration and rows by task
+	rows  []*row
+	byPtr map[*cb.Task]*row
+	// number of lines rendered last time
+	lines int
+	// rendering is stopped and the terminal is left to other output
+	stopped bool
+	now     func() time.Time
+	// return width and height of the terminal. rendering is not limited if it is nil or fails
+	size func() (int, int, error)
+	// log output held while rendering and the writer it is flushed to when stopped
+	logs   bytes.Buffer
+	logOut io.Writer
+}
+
+// snapshot of a task to render without touching tasks while following them
+type row struct {
+	group   string
+	project string
+	number  string
+	phase   string
+	status  string
+	failed  bool
+	ended   bool
+	start   *time.Time
+	end     *time.Time
+}
+
+// return Dashboard which renders to out.
+// rendering is fit into the terminal if out is a terminal
+func New(out io.Writer) *Dashboard {
+	d := &Dashboard{out: out, byPtr: make(map[*cb.Task]*row), now: time.Now}
+	if f, ok := out.(*os.File); ok {
+		d.size = func() (int, int, error) { return term.GetSize(int(f.Fd())) }
+	}
+	return d
+}
+
+// update rows of tasks and render them.
+// it is used as OnUpdate of cb.RunOptions and can be called with a subset of tasks of the run
+func (d *Dashboard) Update(tasks []*cb.Task) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, t := range tasks {
+		r, ok := d.byPtr[t]
+		if !ok {
+			r = &row{}
+			d.byPtr[t] = r
+			d.rows = append(d.rows, r)
+		}
+		*r = row{group: t.Group, project: t.Build.ProjectName, number: "-", phase: "-", status: t.Status, failed: t.Failed(), ended: t.Ended()}
+		if info := t.Info; info != nil {
+			if r.project == "" && info.ProjectName != nil {
+				r.project = *info.ProjectName
+			}
+			if info.BuildNumber != nil {
+				r.number = strconv.FormatInt(*info.BuildNumber, 10)
+			}
+			if info.CurrentPhase != nil {
+				r.phase = *info.CurrentPhase
+			}
+			r.start, r.end = info.StartTime, info.EndTime
+		}
+		if info := t.BatchInfo; info != nil {
+			if r.project == "" && info.ProjectName != nil {
+				r.project = *info.ProjectName
+			}
+			if info.BuildBatchNumber != nil {
+				r.number = strconv.FormatInt(*info.BuildBatchNumber, 10)
+			}
+			if info.CurrentPhase != nil {
+				r.phase = *info.CurrentPhase
+			}
+			r.start, r.end = info.StartTime, info.EndTime
+		}
+	}
+	d.render()
+}
+
+// redraw the dashboard every interval in background.
+// returned function stops it after the last redraw
+func (d *Dashboard) Start(interval time.Duration) func() {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				d.mu.Lock()
+				d.render()
+				d.mu.Unlock()
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.render()
+		d.stopped = true
+		if d.logOut != nil {
+			d.logOut.Write(d.logs.Bytes())
+			d.logs.Reset()
+		}
+	}
+}
+
+// return writer which holds output while the dashboard renders as it would break the rendering.
+// held output is written to out when the dashboard is stopped, and later output goes to out directly
+func (d *Dashboard) LogWriter(out io.Writer) io.Writer {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logOut = out
+	return logWriter{d}
+}
+
+type logWriter struct {
+	d *Dashboard
+}
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w.d.mu.Lock()
+	defer w.d.mu.Unlock()
+	if w.d.stopped {
+		return w.d.logOut.Write(p)
+	}
+	return w.d.logs.Write(p)
+}
+
+// render rows over the last rendered ones.
+// rows are truncated to the width of the terminal and rows of ended builds are left out first
+// when the table is higher than the terminal, as wrapped or scrolled out lines can not be redrawn
+func (d *Dashboard) render() {
+	if d.stopped {
+		return
+	}
+	width, height := 0, 0
+	if d.size != nil {
+		if w, h, err := d.size(); err == nil {
+			width, height = w, h
+		}
+	}
+
+	done, failed := 0, 0
+	for _, r := range d.rows {
+		if r.ended {
+			done++
+		}
+		if r.failed {
+			failed++
+		}
+	}
+	rows, hidden := d.rows, 0
+	// the header, the blank line and the progress bar, and the cursor is left on the line after them
+	if height > 0 && len(rows)+4 > height {
+		// one more line to show the number of hidden rows
+		rows = visibleRows(d.rows, max(height-5, 0))
+		hidden = len(d.rows) - len(rows)
+	}
+
+	headers := []string{"GROUP", "PROJECT", "BUILD", "PHASE", "STATUS", "ELAPSED"}
+	cells := [][]string{headers}
+	for _, r := range rows {
+		cells = append(cells, []string{r.group, r.project, r.number, r.phase, r.status, d.elapsed(r)})
+	}
+	widths := make([]int, len(headers))
+	for _, c := range cells {
+		for i, v := range c {
+			widths[i] = max(widths[i], len(v))
+		}
+	}
+
+	lines := []string{}
+	if height == 0 || height > 4 {
+		for n, c := range cells {
+			cols := make([]string, len(c))
+			statusAt := 0
+			for i, v := range c {
+				if i == 4 {
+					statusAt = len(strings.Join(cols[:i], "  ")) + 2
+				}
+				cols[i] = v + strings.Repeat(" ", widths[i]-len(v))
+			}
+			line := truncate(strings.TrimRight(strings.Join(cols, "  "), " "), width)
+			// status is colored after padding and truncation as escape sequences have no width
+			if status := c[4]; n > 0 && statusAt+len(status) <= len(line) {
+				line = line[:statusAt] + cb.ColoredString(status) + line[statusAt+len(status):]
+			}
+			lines = append(lines, line)
+		}
+		if hidden > 0 {
+			lines = append(lines, truncate(fmt.Sprintf("... %d more build(s)", hidden), width))
+		}
+		lines = append(lines, "")
+	}
+	lines = append(lines, truncate(progressBar(done, failed, len(d.rows)), width))
+
+	var b strings.Builder
+	// move the cursor up to the first line rendered last time and clear the lines below
+	if d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA\x1b[J", d.lines)
+	}
+	for _, l := range lines {
+		// clear the line before writing as the new one can be shorter
+		b.WriteString("\x1b[2K" + l + "\n")
+	}
+	d.lines = len(lines)
+	io.WriteString(d.out, b.String())
+}
+
+// return up to n rows keeping their order. rows of builds which have not ended are preferred
+func visibleRows(rows []*row, n int) []*row {
+	ordered := slices.Clone(rows)
+	slices.SortStableFunc(ordered, func(a, b *row) int {
+		switch {
+		case a.ended == b.ended:
+			return 0
+		case !a.ended:
+			return -1
+		}
+		return 1
+	})
+	visible := ordered[:min(n, len(ordered))]
+	return slices.DeleteFunc(slices.Clone(rows), func(r *row) bool { return !slices.Contains(visible, r) })
+}
+
+// truncate line to fit in width columns of the terminal without wrapping.
+// the last column is left as some terminals wrap a line filling the width
+func truncate(line string, width int) string {
+	if width <= 0 || len(line) < width {
+		return line
+	}
+	n := width - 1
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+	return line[:n]
+}
+
+// return elapsed time of a build of a row
+func (d *Dashboard) elapsed(r *row) string {
+	if r.start == nil {
+		return "-"
+	}
+	end := d.now()
+	if r.end != nil {
+		end = *r.end
+	}
+	return end.Sub(*r.start).Round(time.Second).String()
+}
+
+// return progress bar of ended builds
+func progressBar(done int, failed int, total int) string {
+	filled := 0
+	if total > 0 {
+		filled = barWidth * done / total
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled)
+	return fmt.Sprintf("[%s] %d/%d done, %d failed", bar, done, total, failed)
+}
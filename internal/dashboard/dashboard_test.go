@@ -0,0 +1,171 @@
+package dashboard
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/fatih/color"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestDashboard(t *testing.T) {
+	color.NoColor = true
+	now := time.Date(2023, 8, 19, 15, 0, 0, 0, time.UTC)
+	start := now.Add(-75 * time.Second)
+	end := now.Add(-15 * time.Second)
+	tasks := []*cb.Task{
+		{
+			Group: "group1", Build: types.Build{ProjectName: "proj-a"}, BuildID: "proj-a:1", Status: "IN_PROGRESS",
+			Info: &cbtypes.Build{BuildNumber: aws.Int64(12), CurrentPhase: aws.String("BUILD"), StartTime: &start},
+		},
+		{
+			Group: "group1", Build: types.Build{ProjectName: "proj-b"}, BuildID: "proj-b:1", Status: "FAILED",
+			Info: &cbtypes.Build{BuildNumber: aws.Int64(3), CurrentPhase: aws.String("COMPLETED"), StartTime: &start, EndTime: &end},
+		},
+		{Group: "group2", Build: types.Build{ProjectName: "proj-c"}, Status: cb.StatusPending},
+	}
+
+	var out bytes.Buffer
+	d := New(&out)
+	d.now = func() time.Time { return now }
+	d.Update(tasks)
+	want := []string{
+		"\x1b[2KGROUP   PROJECT  BUILD  PHASE      STATUS       ELAPSED",
+		"\x1b[2Kgroup1  proj-a   12     BUILD      IN_PROGRESS  1m15s",
+		"\x1b[2Kgroup1  proj-b   3      COMPLETED  FAILED       1m0s",
+		"\x1b[2Kgroup2  proj-c   -      -          PENDING      -",
+		"\x1b[2K",
+		"\x1b[2K[##########--------------------] 1/3 done, 1 failed",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Dashboard rendered\n%q\nwant\n%q", got, want)
+	}
+
+	// the next rendering starts with moving the cursor up over the last one
+	out.Reset()
+	tasks[2].Status = cb.StatusSkipped
+	d.Update(tasks[2:])
+	if !strings.HasPrefix(out.String(), "\x1b[6A") {
+		t.Errorf("Dashboard rendered %q, want prefix %q", out.String(), "\x1b[6A")
+	}
+	if !strings.Contains(out.String(), "2/3 done, 2 failed") {
+		t.Errorf("Dashboard rendered %q, want progress %q", out.String(), "2/3 done, 2 failed")
+	}
+
+	// nothing is rendered after stop
+	stop := d.Start(time.Hour)
+	stop()
+	out.Reset()
+	d.Update(tasks)
+	if out.Len() != 0 {
+		t.Errorf("Dashboard rendered %q after stop", out.String())
+	}
+}
+
+func TestDashboardTerminalSize(t *testing.T) {
+	color.NoColor = true
+	tasks := []*cb.Task{
+		{Group: "group1", Build: types.Build{ProjectName: "proj-a"}, Status: "SUCCEEDED"},
+		{Group: "group1", Build: types.Build{ProjectName: "proj-b"}, Status: "FAILED"},
+		{Group: "group1", Build: types.Build{ProjectName: "proj-with-a-long-name"}, Status: "IN_PROGRESS"},
+		{Group: "group2", Build: types.Build{ProjectName: "proj-d"}, Status: cb.StatusPending},
+	}
+	tests := []struct {
+		name   string
+		width  int
+		height int
+		want   []string
+	}{
+		{
+			name:   "rows of ended builds are left out and lines are truncated",
+			width:  40,
+			height: 7,
+			want: []string{
+				"\x1b[2KGROUP   PROJECT                BUILD  P",
+				"\x1b[2Kgroup1  proj-with-a-long-name  -      -",
+				"\x1b[2Kgroup2  proj-d                 -      -",
+				"\x1b[2K... 2 more build(s)",
+				"\x1b[2K",
+				"\x1b[2K[###############---------------] 2/4 do",
+			},
+		},
+		{
+			name:   "only progress bar in a low terminal",
+			width:  80,
+			height: 4,
+			want: []string{
+				"\x1b[2K[###############---------------] 2/4 done, 1 failed",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			d := New(&out)
+			d.size = func() (int, int, error) { return tt.width, tt.height, nil }
+			d.Update(tasks)
+			got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Dashboard rendered\n%q\nwant\n%q", got, tt.want)
+			}
+			for _, l := range got {
+				if n := len(strings.TrimPrefix(l, "\x1b[2K")); n >= tt.width {
+					t.Errorf("Dashboard rendered %q longer than the width %d", l, tt.width)
+				}
+			}
+			if len(got) >= tt.height {
+				t.Errorf("Dashboard rendered %d lines higher than the height %d", len(got), tt.height)
+			}
+		})
+	}
+}
+
+// client failing to start builds
+type failingClient struct {
+	cb.CodeBuildAPI
+}
+
+func (failingClient) StartBuild(ctx context.Context, params *codebuild.StartBuildInput, optFns ...func(*codebuild.Options)) (*codebuild.StartBuildOutput, error) {
+	return nil, errors.New("AccessDenied")
+}
+
+func TestDashboardLogWriter(t *testing.T) {
+	color.NoColor = true
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	tasks := []*cb.Task{{Group: "group1", Build: types.Build{ProjectName: "proj-a"}, Status: cb.StatusPending}}
+
+	var out, errs bytes.Buffer
+	d := New(&out)
+	d.Update(tasks)
+	stop := d.Start(time.Hour)
+	log.SetOutput(d.LogWriter(&errs))
+	cb.StartReadyTasks(failingClient{}, tasks, cb.RunOptions{})
+	d.Update(tasks)
+	// the error is held not to break the dashboard
+	if errs.Len() != 0 || strings.Contains(out.String(), "AccessDenied") {
+		t.Errorf("log written while the dashboard renders: %q, %q", errs.String(), out.String())
+	}
+
+	// and shown after the dashboard stops
+	stop()
+	want := "failed to start build for proj-a: AccessDenied"
+	if !strings.Contains(errs.String(), want) {
+		t.Errorf("log after stop = %q, want containing %q", errs.String(), want)
+	}
+	errs.Reset()
+	log.Print("after stop")
+	if !strings.Contains(errs.String(), "after stop") {
+		t.Errorf("log after stop = %q, want containing %q", errs.String(), "after stop")
+	}
+}
@@ -0,0 +1,150 @@
+package report
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+// name of the test suite for builds of the list format config
+const defaultSuiteName = "builds"
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      float64         `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+	// start time of the first build in the suite
+	start time.Time
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// write a JUnit XML report of tasks to path.
+// each group becomes a testsuite and each build becomes a testcase
+func WriteJUnit(path string, tasks []*cb.Task) error {
+	b, err := MarshalJUnit(tasks)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// return a JUnit XML report of tasks
+func MarshalJUnit(tasks []*cb.Task) ([]byte, error) {
+	report := junitTestSuites{Name: "codebuild-multirunner"}
+	suiteIndex := map[string]int{}
+	for _, t := range tasks {
+		name := t.Group
+		if name == "" {
+			name = defaultSuiteName
+		}
+		i, ok := suiteIndex[name]
+		if !ok {
+			i = len(report.Suites)
+			suiteIndex[name] = i
+			report.Suites = append(report.Suites, junitTestSuite{Name: name})
+		}
+		suite := &report.Suites[i]
+		r := NewBuildRecord(t, "")
+		tc := newJUnitTestCase(t, r, name)
+		suite.Tests++
+		switch {
+		case tc.Failure != nil:
+			suite.Failures++
+		case tc.Error != nil:
+			suite.Errors++
+		case tc.Skipped != nil:
+			suite.Skipped++
+		}
+		suite.Time += tc.Time
+		if r.StartTime != nil && (suite.start.IsZero() || r.StartTime.Before(suite.start)) {
+			suite.start = *r.StartTime
+			suite.Timestamp = suite.start.UTC().Format("2006-01-02T15:04:05")
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+	for _, s := range report.Suites {
+		report.Tests += s.Tests
+		report.Failures += s.Failures
+		report.Errors += s.Errors
+		report.Skipped += s.Skipped
+		report.Time += s.Time
+	}
+	b, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(b, '\n')...), nil
+}
+
+// return a testcase of a task
+func newJUnitTestCase(t *cb.Task, r BuildRecord, classname string) junitTestCase {
+	tc := junitTestCase{Name: r.Name, Classname: classname, Time: r.DurationSeconds}
+	var out []string
+	for _, id := range t.BuildIDs() {
+		out = append(out, "build id: "+id)
+	}
+	if r.Logs != nil && r.Logs.DeepLink != "" {
+		out = append(out, "logs: "+r.Logs.DeepLink)
+	}
+	tc.SystemOut = strings.Join(out, "\n")
+
+	switch {
+	case t.Status == cb.StatusSkipped:
+		tc.Skipped = &junitMessage{Message: "build was skipped"}
+	case t.Status == cb.StatusFailedToStart || t.Status == cb.StatusNotFound:
+		msg := fmt.Sprintf("build %s", t.Status)
+		if r.Error != "" {
+			msg += ": " + r.Error
+		}
+		tc.Error = &junitMessage{Message: msg, Type: t.Status}
+	case t.Failed():
+		// failure message is taken from contexts of failed phases
+		var phases []string
+		for _, p := range t.FailedPhases() {
+			phases = append(phases, cb.PhaseMessage(p))
+		}
+		msg := fmt.Sprintf("build %s", t.Status)
+		if len(phases) > 0 {
+			msg = phases[0]
+		}
+		tc.Failure = &junitMessage{Message: msg, Type: t.Status, Text: strings.Join(phases, "\n")}
+	case !t.Ended():
+		tc.Skipped = &junitMessage{Message: fmt.Sprintf("build was left %s", t.Status)}
+	}
+	return tc
+}
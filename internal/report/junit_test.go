@@ -0,0 +1,106 @@
+package report
+
+import (
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	start := time.Date(2023, 8, 19, 15, 0, 0, 0, time.UTC)
+	end := start.Add(30 * time.Second)
+	tasks := []*cb.Task{
+		{
+			Group: "infra", Build: types.Build{ProjectName: "proj-a"}, BuildID: "proj-a:1", Status: "SUCCEEDED",
+			Info: &cbtypes.Build{StartTime: &start, EndTime: &end},
+		},
+		{
+			Group: "infra", Build: types.Build{ProjectName: "proj-b"}, BuildID: "proj-b:1", Status: "FAILED",
+			Info: &cbtypes.Build{
+				StartTime: &start,
+				EndTime:   &end,
+				Phases: []cbtypes.BuildPhase{
+					{PhaseType: cbtypes.BuildPhaseTypeInstall, PhaseStatus: cbtypes.StatusTypeSucceeded},
+					{
+						PhaseType:   cbtypes.BuildPhaseTypeBuild,
+						PhaseStatus: cbtypes.StatusTypeFailed,
+						Contexts: []cbtypes.PhaseContext{{
+							StatusCode: aws.String("COMMAND_EXECUTION_ERROR"),
+							Message:    aws.String("Error while executing command: make. Reason: exit status 2"),
+						}},
+					},
+					{PhaseType: cbtypes.BuildPhaseTypeCompleted},
+				},
+			},
+		},
+		{Group: "app", Build: types.Build{ProjectName: "proj-c"}, Status: cb.StatusSkipped},
+		{Group: "app", Build: types.Build{ProjectName: "proj-d"}, Status: cb.StatusFailedToStart, Err: errors.New("access denied")},
+	}
+	path := filepath.Join(t.TempDir(), "report.xml")
+	if err := WriteJUnit(path, tasks); err != nil {
+		t.Fatalf("WriteJUnit() error = %v", err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatalf("invalid xml: %v", err)
+	}
+
+	if got.Tests != 4 || got.Failures != 1 || got.Errors != 1 || got.Skipped != 1 || got.Time != 60 {
+		t.Errorf("WriteJUnit() testsuites = tests %d failures %d errors %d skipped %d time %v", got.Tests, got.Failures, got.Errors, got.Skipped, got.Time)
+	}
+	var suites []string
+	for _, s := range got.Suites {
+		suites = append(suites, s.Name)
+	}
+	if !reflect.DeepEqual(suites, []string{"infra", "app"}) {
+		t.Errorf("WriteJUnit() testsuites = %v, want %v", suites, []string{"infra", "app"})
+	}
+	if got.Suites[0].Timestamp != "2023-08-19T15:00:00" {
+		t.Errorf("WriteJUnit() timestamp = %v", got.Suites[0].Timestamp)
+	}
+
+	failure := got.Suites[0].Cases[1].Failure
+	wantMessage := "BUILD FAILED: COMMAND_EXECUTION_ERROR: Error while executing command: make. Reason: exit status 2"
+	if failure == nil || failure.Message != wantMessage || failure.Type != "FAILED" {
+		t.Errorf("WriteJUnit() failure = %+v, want message %q", failure, wantMessage)
+	}
+	if got.Suites[0].Cases[0].Failure != nil {
+		t.Errorf("WriteJUnit() succeeded build has failure %+v", got.Suites[0].Cases[0].Failure)
+	}
+	if got.Suites[1].Cases[0].Skipped == nil {
+		t.Errorf("WriteJUnit() skipped build has no skipped element")
+	}
+	if e := got.Suites[1].Cases[1].Error; e == nil || e.Message != "build FAILED_TO_START: access denied" {
+		t.Errorf("WriteJUnit() error = %+v", e)
+	}
+}
+
+func TestWriteJUnitListFormat(t *testing.T) {
+	b, err := MarshalJUnit([]*cb.Task{{Build: types.Build{ProjectName: "proj"}, BuildID: "proj:1", Status: "STOPPED"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got junitTestSuites
+	if err := xml.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Suites[0].Name != defaultSuiteName {
+		t.Errorf("MarshalJUnit() testsuite name = %v, want %v", got.Suites[0].Name, defaultSuiteName)
+	}
+	if f := got.Suites[0].Cases[0].Failure; f == nil || f.Message != "build STOPPED" {
+		t.Errorf("MarshalJUnit() failure = %+v, want message %q", f, "build STOPPED")
+	}
+}
@@ -0,0 +1,251 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+// output formats
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// record types in ndjson
+const (
+	typeBuild   = "build"
+	typeSummary = "summary"
+)
+
+// BuildRecord is a result of a build entry
+type BuildRecord struct {
+	Type            string     `json:"type,omitempty"`
+	Name            string     `json:"name,omitempty"`
+	Group           string     `json:"group,omitempty"`
+	ProjectName     string     `json:"projectName,omitempty"`
+	BuildID         string     `json:"buildId,omitempty"`
+	Arn             string     `json:"arn,omitempty"`
+	BuildNumber     int64      `json:"buildNumber,omitempty"`
+	Status          string     `json:"status"`
+	StartTime       *time.Time `json:"startTime,omitempty"`
+	EndTime         *time.Time `json:"endTime,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds,omitempty"`
+	Logs            *LogLinks  `json:"logs,omitempty"`
+	Attempts        []Attempt  `json:"attempts,omitempty"`
+	// builds in the batch build for batch entries
+	BatchBuilds []BatchBuild `json:"batchBuilds,omitempty"`
+	Error       string       `json:"error,omitempty"`
+}
+
+// LogLinks are locations of logs of a build
+type LogLinks struct {
+	DeepLink   string `json:"deepLink,omitempty"`
+	S3DeepLink string `json:"s3DeepLink,omitempty"`
+	GroupName  string `json:"groupName,omitempty"`
+	StreamName string `json:"streamName,omitempty"`
+}
+
+// Attempt is a failed build which was retried
+type Attempt struct {
+	BuildID string `json:"buildId"`
+	Status  string `json:"status"`
+}
+
+// BatchBuild is a build in a batch build
+type BatchBuild struct {
+	Identifier string `json:"identifier"`
+	BuildID    string `json:"buildId,omitempty"`
+	Status     string `json:"status"`
+}
+
+// Summary is an overall result of a run
+type Summary struct {
+	Type            string    `json:"type,omitempty"`
+	Status          string    `json:"status"`
+	Total           int       `json:"total"`
+	Succeeded       int       `json:"succeeded"`
+	Failed          int       `json:"failed"`
+	Skipped         int       `json:"skipped"`
+	InProgress      int       `json:"inProgress"`
+	StartTime       time.Time `json:"startTime"`
+	EndTime         time.Time `json:"endTime"`
+	DurationSeconds float64   `json:"durationSeconds"`
+}
+
+// Writer writes results of tasks in a run as json or ndjson.
+// json writes a whole document on Finish, ndjson writes a record as soon as each task ends
+type Writer struct {
+	out       io.Writer
+	format    string
+	startTime time.Time
+	tasks     []*cb.Task
+	written   map[*cb.Task]bool
+	err       error
+}
+
+// return Writer for the format. nil is returned for the text format
+func NewWriter(out io.Writer, format string) (*Writer, error) {
+	switch format {
+	case FormatText:
+		return nil, nil
+	case FormatJSON, FormatNDJSON:
+		return &Writer{out: out, format: format, startTime: time.Now(), written: make(map[*cb.Task]bool)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported output format '%s'. use one of %s, %s, %s", format, FormatText, FormatJSON, FormatNDJSON)
+	}
+}
+
+// register tasks and write records of ended tasks for ndjson.
+// it can be called with a subset of tasks of the run
+func (w *Writer) Update(tasks []*cb.Task) {
+	for _, t := range tasks {
+		if _, ok := w.written[t]; !ok {
+			w.tasks = append(w.tasks, t)
+			w.written[t] = false
+		}
+		if w.format == FormatNDJSON && t.Ended() && !w.written[t] {
+			w.written[t] = true
+			w.encode(NewBuildRecord(t, typeBuild))
+		}
+	}
+}
+
+// write remaining records and the summary
+func (w *Writer) Finish() error {
+	if w.format == FormatNDJSON {
+		for _, t := range w.tasks {
+			if !w.written[t] {
+				w.written[t] = true
+				w.encode(NewBuildRecord(t, typeBuild))
+			}
+		}
+		w.encode(w.summary(typeSummary))
+		return w.err
+	}
+	records := make([]BuildRecord, 0, len(w.tasks))
+	for _, t := range w.tasks {
+		records = append(records, NewBuildRecord(t, ""))
+	}
+	w.encode(struct {
+		Builds  []BuildRecord `json:"builds"`
+		Summary Summary       `json:"summary"`
+	}{records, w.summary("")})
+	return w.err
+}
+
+// write v as json. the first error is kept and returned by Finish
+func (w *Writer) encode(v any) {
+	if w.err != nil {
+		return
+	}
+	enc := json.NewEncoder(w.out)
+	if w.format == FormatJSON {
+		enc.SetIndent("", "  ")
+	}
+	w.err = enc.Encode(v)
+}
+
+// return summary of registered tasks
+func (w *Writer) summary(recordType string) Summary {
+	s := Summary{Type: recordType, Status: "SUCCEEDED", Total: len(w.tasks), StartTime: w.startTime, EndTime: time.Now()}
+	s.DurationSeconds = s.EndTime.Sub(s.StartTime).Seconds()
+	for _, t := range w.tasks {
+		switch {
+		case t.Status == cb.StatusSkipped:
+			s.Skipped++
+		case t.Failed():
+			s.Failed++
+		case t.Ended():
+			s.Succeeded++
+		default:
+			s.InProgress++
+		}
+	}
+	// builds are left running with --no-wait option
+	switch {
+	case s.Failed > 0 || s.Skipped > 0:
+		s.Status = "FAILED"
+	case s.InProgress > 0:
+		s.Status = "IN_PROGRESS"
+	}
+	return s
+}
+
+// return record of a task
+func NewBuildRecord(t *cb.Task, recordType string) BuildRecord {
+	r := BuildRecord{
+		Type:        recordType,
+		Name:        t.Name(),
+		Group:       t.Group,
+		ProjectName: t.Build.ProjectName,
+		BuildID:     t.BuildID,
+		Status:      t.Status,
+	}
+	if t.Err != nil {
+		r.Error = t.Err.Error()
+	}
+	for _, a := range t.Attempts {
+		r.Attempts = append(r.Attempts, Attempt(a))
+	}
+	for _, c := range t.BatchChildren() {
+		r.BatchBuilds = append(r.BatchBuilds, BatchBuild(c))
+	}
+	if b := t.BatchInfo; b != nil {
+		r.ProjectName = deref(b.ProjectName)
+		if r.Name == "" {
+			r.Name = r.ProjectName
+		}
+		r.Arn = deref(b.Arn)
+		if b.BuildBatchNumber != nil {
+			r.BuildNumber = *b.BuildBatchNumber
+		}
+		r.StartTime = b.StartTime
+		r.EndTime = b.EndTime
+		if b.StartTime != nil && b.EndTime != nil {
+			r.DurationSeconds = b.EndTime.Sub(*b.StartTime).Seconds()
+		}
+	}
+	info := t.Info
+	if info == nil {
+		return r
+	}
+	if info.ProjectName != nil {
+		r.ProjectName = *info.ProjectName
+	}
+	if r.Name == "" {
+		r.Name = r.ProjectName
+	}
+	if info.Arn != nil {
+		r.Arn = *info.Arn
+	}
+	if info.BuildNumber != nil {
+		r.BuildNumber = *info.BuildNumber
+	}
+	r.StartTime = info.StartTime
+	r.EndTime = info.EndTime
+	if info.StartTime != nil && info.EndTime != nil {
+		r.DurationSeconds = info.EndTime.Sub(*info.StartTime).Seconds()
+	}
+	if l := info.Logs; l != nil {
+		r.Logs = &LogLinks{
+			DeepLink:   deref(l.DeepLink),
+			S3DeepLink: deref(l.S3DeepLink),
+			GroupName:  deref(l.GroupName),
+			StreamName: deref(l.StreamName),
+		}
+	}
+	return r
+}
+
+// return value of a string pointer or empty string for nil
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,245 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestNewWriter(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		wantNil bool
+		wantErr bool
+	}{
+		{name: "text", format: FormatText, wantNil: true},
+		{name: "json", format: FormatJSON},
+		{name: "ndjson", format: FormatNDJSON},
+		{name: "unsupported", format: "yaml", wantNil: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewWriter(&bytes.Buffer{}, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewWriter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (got == nil) != tt.wantNil {
+				t.Errorf("NewWriter() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestNewBuildRecord(t *testing.T) {
+	start := time.Date(2023, 8, 19, 15, 0, 0, 0, time.UTC)
+	end := start.Add(90 * time.Second)
+	tests := []struct {
+		name string
+		task *cb.Task
+		want BuildRecord
+	}{
+		{
+			name: "ended build",
+			task: &cb.Task{
+				Group:    "group1",
+				Build:    types.Build{ProjectName: "proj"},
+				BuildID:  "proj:2",
+				Status:   "SUCCEEDED",
+				Attempts: []cb.Attempt{{BuildID: "proj:1", Status: "FAILED"}},
+				Info: &cbtypes.Build{
+					Id:          aws.String("proj:2"),
+					Arn:         aws.String("arn:aws:codebuild:ap-northeast-1:123456789012:build/proj:2"),
+					ProjectName: aws.String("proj"),
+					BuildNumber: aws.Int64(2),
+					StartTime:   &start,
+					EndTime:     &end,
+					Logs: &cbtypes.LogsLocation{
+						DeepLink:   aws.String("https://example.com/log"),
+						GroupName:  aws.String("/aws/codebuild/proj"),
+						StreamName: aws.String("stream"),
+					},
+				},
+			},
+			want: BuildRecord{
+				Type:            typeBuild,
+				Name:            "proj",
+				Group:           "group1",
+				ProjectName:     "proj",
+				BuildID:         "proj:2",
+				Arn:             "arn:aws:codebuild:ap-northeast-1:123456789012:build/proj:2",
+				BuildNumber:     2,
+				Status:          "SUCCEEDED",
+				StartTime:       &start,
+				EndTime:         &end,
+				DurationSeconds: 90,
+				Logs:            &LogLinks{DeepLink: "https://example.com/log", GroupName: "/aws/codebuild/proj", StreamName: "stream"},
+				Attempts:        []Attempt{{BuildID: "proj:1", Status: "FAILED"}},
+			},
+		},
+		{
+			name: "failed to start",
+			task: &cb.Task{
+				Build:  types.Build{RunnerOptions: types.RunnerOptions{ID: "app"}, ProjectName: "proj"},
+				Status: cb.StatusFailedToStart,
+				Err:    errors.New("access denied"),
+			},
+			want: BuildRecord{
+				Type:        typeBuild,
+				Name:        "app",
+				ProjectName: "proj",
+				Status:      cb.StatusFailedToStart,
+				Error:       "access denied",
+			},
+		},
+		{
+			name: "project name from build info",
+			task: &cb.Task{
+				BuildID: "proj:1",
+				Status:  "IN_PROGRESS",
+				Info:    &cbtypes.Build{ProjectName: aws.String("proj")},
+			},
+			want: BuildRecord{
+				Type:        typeBuild,
+				Name:        "proj",
+				ProjectName: "proj",
+				BuildID:     "proj:1",
+				Status:      "IN_PROGRESS",
+			},
+		},
+		{
+			name: "batch build",
+			task: &cb.Task{
+				Build:   types.Build{RunnerOptions: types.RunnerOptions{Batch: true}, ProjectName: "proj"},
+				BuildID: "proj:batch",
+				Status:  "FAILED",
+				BatchInfo: &cbtypes.BuildBatch{
+					ProjectName:      aws.String("proj"),
+					BuildBatchNumber: aws.Int64(3),
+					StartTime:        &start,
+					EndTime:          &end,
+					BuildGroups: []cbtypes.BuildGroup{{
+						Identifier:          aws.String("build1"),
+						CurrentBuildSummary: &cbtypes.BuildSummary{Arn: aws.String("arn:aws:codebuild:ap-northeast-1:123456789012:build/proj:1"), BuildStatus: cbtypes.StatusTypeFailed},
+					}},
+				},
+			},
+			want: BuildRecord{
+				Type:            typeBuild,
+				Name:            "proj",
+				ProjectName:     "proj",
+				BuildID:         "proj:batch",
+				BuildNumber:     3,
+				Status:          "FAILED",
+				StartTime:       &start,
+				EndTime:         &end,
+				DurationSeconds: 90,
+				BatchBuilds:     []BatchBuild{{Identifier: "build1", BuildID: "proj:1", Status: "FAILED"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewBuildRecord(tt.task, typeBuild); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewBuildRecord() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	newTasks := func() []*cb.Task {
+		return []*cb.Task{
+			{Build: types.Build{ProjectName: "a"}, BuildID: "a:1", Status: "IN_PROGRESS"},
+			{Build: types.Build{ProjectName: "b"}, BuildID: "b:1", Status: "IN_PROGRESS"},
+			{Build: types.Build{ProjectName: "c"}, Status: cb.StatusPending},
+		}
+	}
+	tests := []struct {
+		name        string
+		format      string
+		wantLines   []string
+		wantSummary Summary
+	}{
+		{
+			name:   "ndjson",
+			format: FormatNDJSON,
+			// records are written in the order builds ended
+			wantLines:   []string{"build b FAILED", "build a SUCCEEDED", "build c SKIPPED", "summary"},
+			wantSummary: Summary{Type: typeSummary, Status: "FAILED", Total: 3, Succeeded: 1, Failed: 1, Skipped: 1},
+		},
+		{
+			name:        "json",
+			format:      FormatJSON,
+			wantLines:   []string{"build a SUCCEEDED", "build b FAILED", "build c SKIPPED", "summary"},
+			wantSummary: Summary{Status: "FAILED", Total: 3, Succeeded: 1, Failed: 1, Skipped: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tasks := newTasks()
+			w.Update(tasks)
+			tasks[1].Status = "FAILED"
+			w.Update(tasks)
+			tasks[0].Status = "SUCCEEDED"
+			// a subset of tasks is updated while following a stage
+			w.Update(tasks[:1])
+			tasks[2].Status = cb.StatusSkipped
+			if err := w.Finish(); err != nil {
+				t.Fatal(err)
+			}
+
+			var records []BuildRecord
+			var summary Summary
+			if tt.format == FormatNDJSON {
+				lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+				for _, line := range lines[:len(lines)-1] {
+					var r BuildRecord
+					if err := json.Unmarshal([]byte(line), &r); err != nil {
+						t.Fatal(err)
+					}
+					records = append(records, r)
+				}
+				if err := json.Unmarshal([]byte(lines[len(lines)-1]), &summary); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				var doc struct {
+					Builds  []BuildRecord `json:"builds"`
+					Summary Summary       `json:"summary"`
+				}
+				if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+					t.Fatal(err)
+				}
+				records, summary = doc.Builds, doc.Summary
+			}
+
+			var got []string
+			for _, r := range records {
+				got = append(got, "build "+r.Name+" "+r.Status)
+			}
+			got = append(got, "summary")
+			if !reflect.DeepEqual(got, tt.wantLines) {
+				t.Errorf("Writer output = %v, want %v", got, tt.wantLines)
+			}
+			summary.StartTime, summary.EndTime, summary.DurationSeconds = time.Time{}, time.Time{}, 0
+			if !reflect.DeepEqual(summary, tt.wantSummary) {
+				t.Errorf("Writer summary = %+v, want %+v", summary, tt.wantSummary)
+			}
+		})
+	}
+}
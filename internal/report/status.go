@@ -0,0 +1,112 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+// StatusRecord is a status of a build
+type StatusRecord struct {
+	BuildID         string     `json:"buildId"`
+	ProjectName     string     `json:"projectName,omitempty"`
+	BuildNumber     int64      `json:"buildNumber,omitempty"`
+	Status          string     `json:"status"`
+	CurrentPhase    string     `json:"currentPhase,omitempty"`
+	Initiator       string     `json:"initiator,omitempty"`
+	SourceVersion   string     `json:"sourceVersion,omitempty"`
+	StartTime       *time.Time `json:"startTime,omitempty"`
+	EndTime         *time.Time `json:"endTime,omitempty"`
+	DurationSeconds float64    `json:"durationSeconds,omitempty"`
+}
+
+// return status records of builds in the order of ids. ids which are not found are NOT_FOUND
+func NewStatusRecords(ids []string, builds []cbtypes.Build) []StatusRecord {
+	byID := make(map[string]cbtypes.Build, len(builds))
+	for _, b := range builds {
+		byID[deref(b.Id)] = b
+	}
+	records := make([]StatusRecord, 0, len(ids))
+	for _, id := range ids {
+		b, ok := byID[id]
+		if !ok {
+			records = append(records, StatusRecord{BuildID: id, Status: cb.StatusNotFound})
+			continue
+		}
+		r := StatusRecord{
+			BuildID:       id,
+			ProjectName:   deref(b.ProjectName),
+			Status:        string(b.BuildStatus),
+			CurrentPhase:  deref(b.CurrentPhase),
+			Initiator:     deref(b.Initiator),
+			SourceVersion: deref(b.ResolvedSourceVersion),
+			StartTime:     b.StartTime,
+			EndTime:       b.EndTime,
+		}
+		if r.SourceVersion == "" {
+			r.SourceVersion = deref(b.SourceVersion)
+		}
+		if b.BuildNumber != nil {
+			r.BuildNumber = *b.BuildNumber
+		}
+		if b.StartTime != nil {
+			end := time.Now()
+			if b.EndTime != nil {
+				end = *b.EndTime
+			}
+			r.DurationSeconds = end.Sub(*b.StartTime).Round(time.Second).Seconds()
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+// write status records as a table for the text format or as a json array
+func WriteStatus(out io.Writer, format string, records []StatusRecord) error {
+	switch format {
+	case FormatText:
+	case FormatJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	default:
+		return fmt.Errorf("unsupported output format '%s'. use one of %s, %s", format, FormatText, FormatJSON)
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUILD ID\tNUMBER\tSTATUS\tPHASE\tINITIATOR\tSOURCE VERSION\tSTART\tEND\tDURATION")
+	for _, r := range records {
+		number, duration := "-", "-"
+		if r.BuildNumber != 0 {
+			number = strconv.FormatInt(r.BuildNumber, 10)
+		}
+		if r.StartTime != nil {
+			duration = (time.Duration(r.DurationSeconds) * time.Second).String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.BuildID, number, r.Status, orDash(r.CurrentPhase), orDash(r.Initiator), orDash(r.SourceVersion),
+			formatTime(r.StartTime), formatTime(r.EndTime), duration)
+	}
+	return tw.Flush()
+}
+
+// return local time in a table or "-" for nil
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Local().Format(time.DateTime)
+}
+
+// return s or "-" for empty string
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
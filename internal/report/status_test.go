@@ -0,0 +1,104 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+)
+
+func TestNewStatusRecords(t *testing.T) {
+	start := time.Date(2023, 8, 19, 15, 0, 0, 0, time.UTC)
+	end := start.Add(100 * time.Second)
+	builds := []cbtypes.Build{
+		{
+			Id:                    aws.String("proj:2"),
+			ProjectName:           aws.String("proj"),
+			BuildNumber:           aws.Int64(2),
+			BuildStatus:           cbtypes.StatusTypeSucceeded,
+			CurrentPhase:          aws.String("COMPLETED"),
+			Initiator:             aws.String("user"),
+			SourceVersion:         aws.String("main"),
+			ResolvedSourceVersion: aws.String("0123abcd"),
+			StartTime:             &start,
+			EndTime:               &end,
+		},
+		{Id: aws.String("proj:1"), ProjectName: aws.String("proj"), BuildStatus: cbtypes.StatusTypeInProgress, SourceVersion: aws.String("main")},
+	}
+	got := NewStatusRecords([]string{"proj:1", "proj:2", "proj:3"}, builds)
+	want := []StatusRecord{
+		{BuildID: "proj:1", ProjectName: "proj", Status: "IN_PROGRESS", SourceVersion: "main"},
+		{
+			BuildID: "proj:2", ProjectName: "proj", BuildNumber: 2, Status: "SUCCEEDED", CurrentPhase: "COMPLETED",
+			Initiator: "user", SourceVersion: "0123abcd", StartTime: &start, EndTime: &end, DurationSeconds: 100,
+		},
+		{BuildID: "proj:3", Status: "NOT_FOUND"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("NewStatusRecords() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	start := time.Date(2023, 8, 19, 15, 0, 0, 0, time.UTC)
+	records := []StatusRecord{
+		{BuildID: "proj:2", BuildNumber: 2, Status: "SUCCEEDED", StartTime: &start, DurationSeconds: 100},
+		{BuildID: "proj:3", Status: "NOT_FOUND"},
+	}
+	tests := []struct {
+		name    string
+		format  string
+		check   func(t *testing.T, out string)
+		wantErr bool
+	}{
+		{
+			name:   "table",
+			format: FormatText,
+			check: func(t *testing.T, out string) {
+				lines := strings.Split(strings.TrimSpace(out), "\n")
+				if len(lines) != 3 || !strings.HasPrefix(lines[0], "BUILD ID") {
+					t.Errorf("WriteStatus() = %q", out)
+					return
+				}
+				if fields := strings.Fields(lines[1]); fields[0] != "proj:2" || fields[1] != "2" || fields[2] != "SUCCEEDED" || fields[len(fields)-1] != "1m40s" {
+					t.Errorf("WriteStatus() row = %q", lines[1])
+				}
+				if fields := strings.Fields(lines[2]); fields[0] != "proj:3" || fields[2] != "NOT_FOUND" {
+					t.Errorf("WriteStatus() row = %q", lines[2])
+				}
+			},
+		},
+		{
+			name:   "json",
+			format: FormatJSON,
+			check: func(t *testing.T, out string) {
+				var got []StatusRecord
+				if err := json.Unmarshal([]byte(out), &got); err != nil {
+					t.Fatal(err)
+				}
+				if len(got) != 2 || got[0].BuildID != "proj:2" || got[1].Status != "NOT_FOUND" {
+					t.Errorf("WriteStatus() = %+v", got)
+				}
+			},
+		},
+		{name: "unsupported", format: FormatNDJSON, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := WriteStatus(&out, tt.format, records)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("WriteStatus() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.check != nil {
+				tt.check(t, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package runstate
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+// directory to save state files of runs
+const DefaultDir = ".codebuild-multirunner/runs"
+
+// Run is a record of builds in a run persisted to <dir>/<id>.json
+type Run struct {
+	ID          string    `json:"id"`
+	ConfigFiles []string  `json:"configFiles,omitempty"`
+	StartTime   time.Time `json:"startTime"`
+	UpdateTime  time.Time `json:"updateTime"`
+	Builds      []Build   `json:"builds"`
+	dir         string
+	// tasks recorded in Builds in the order of registration
+	tasks []*cb.Task
+}
+
+// Build is a record of a build entry in a run
+type Build struct {
+	Group string `json:"group,omitempty"`
+	Name  string `json:"name"`
+	// build entry of the config file
+	Entry    map[string]any `json:"entry"`
+	BuildID  string         `json:"buildId,omitempty"`
+	Status   string         `json:"status"`
+	Attempts []Attempt      `json:"attempts,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+// Attempt is a failed build which was retried
+type Attempt struct {
+	BuildID string `json:"buildId"`
+	Status  string `json:"status"`
+}
+
+// return a new Run with a generated id
+func New(dir string, configFiles []string) (*Run, error) {
+	b := make([]byte, 3)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	id := now.Format("20060102-150405") + "-" + hex.EncodeToString(b)
+	return &Run{ID: id, ConfigFiles: configFiles, StartTime: now, dir: dir}, nil
+}
+
+// load a Run from its state file
+func Load(dir string, id string) (*Run, error) {
+	r := &Run{dir: dir}
+	b, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read run '%s': %w", id, err)
+	}
+	if err := json.Unmarshal(b, r); err != nil {
+		return nil, fmt.Errorf("failed to parse run '%s': %w", id, err)
+	}
+	return r, nil
+}
+
+// return path of the state file
+func (r *Run) Path() string {
+	return filepath.Join(r.dir, r.ID+".json")
+}
+
+// return tasks of recorded builds. the tasks are recorded on Update
+func (r *Run) Tasks() ([]*cb.Task, error) {
+	tasks := make([]*cb.Task, 0, len(r.Builds))
+	for _, b := range r.Builds {
+		entry, err := mapToEntry(b.Entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse build '%s' of run '%s': %w", b.Name, r.ID, err)
+		}
+		t := &cb.Task{Group: b.Group, Build: entry, BuildID: b.BuildID, Status: b.Status}
+		for _, a := range b.Attempts {
+			t.Attempts = append(t.Attempts, cb.Attempt(a))
+		}
+		tasks = append(tasks, t)
+	}
+	r.tasks = tasks
+	return tasks, nil
+}
+
+// register tasks and save the state file. errors are logged as a run should go on without its state.
+// it is used as OnUpdate of cb.RunOptions and can be called with a subset of tasks of the run
+func (r *Run) Update(tasks []*cb.Task) {
+	for _, t := range tasks {
+		if !slices.Contains(r.tasks, t) {
+			r.tasks = append(r.tasks, t)
+		}
+	}
+	if err := r.Save(); err != nil {
+		log.Printf("failed to save state of run '%s': %v\n", r.ID, err)
+	}
+}
+
+// write records of tasks to the state file
+func (r *Run) Save() error {
+	builds := make([]Build, 0, len(r.tasks))
+	for _, t := range r.tasks {
+		entry, err := entryToMap(t.Build)
+		if err != nil {
+			return err
+		}
+		b := Build{Group: t.Group, Name: t.Name(), Entry: entry, BuildID: t.BuildID, Status: t.Status}
+		for _, a := range t.Attempts {
+			b.Attempts = append(b.Attempts, Attempt(a))
+		}
+		if t.Err != nil {
+			b.Error = t.Err.Error()
+		}
+		builds = append(builds, b)
+	}
+	r.Builds = builds
+	r.UpdateTime = time.Now()
+
+	d, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(r.dir, 0o755); err != nil {
+		return err
+	}
+	// write to a temporary file and rename it not to leave a broken state file
+	tmp := r.Path() + ".tmp"
+	if err := os.WriteFile(tmp, d, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.Path())
+}
+
+// return tasks to rerun builds which did not succeed, with dependencies on other builds removed
+// as they have already succeeded
+func RerunTasks(tasks []*cb.Task) []*cb.Task {
+	rerun := []*cb.Task{}
+	ids := map[string]bool{}
+	for _, t := range tasks {
+		if t.Failed() {
+			rerun = append(rerun, &cb.Task{Group: t.Group, Build: t.Build, Status: cb.StatusPending})
+			if t.Build.ID != "" {
+				ids[t.Build.ID] = true
+			}
+		}
+	}
+	for _, t := range rerun {
+		deps := []string{}
+		for _, d := range t.Build.DependsOn {
+			if ids[d] {
+				deps = append(deps, d)
+			}
+		}
+		t.Build.DependsOn = deps
+	}
+	return rerun
+}
+
+// return groups of builds of tasks keeping the order
+func Groups(tasks []*cb.Task) []cb.BuildGroup {
+	groups := []cb.BuildGroup{}
+	for i, t := range tasks {
+		if i == 0 || t.Group != tasks[i-1].Group {
+			groups = append(groups, cb.BuildGroup{Name: t.Group})
+		}
+		groups[len(groups)-1].Builds = append(groups[len(groups)-1].Builds, t.Build)
+	}
+	return groups
+}
+
+// convert a build entry to a map with keys of the config file
+func entryToMap(b types.Build) (map[string]any, error) {
+	d, err := yaml.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]any{}
+	if err := yaml.Unmarshal(d, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// convert a map with keys of the config file to a build entry
+func mapToEntry(m map[string]any) (types.Build, error) {
+	b := types.Build{}
+	d, err := yaml.Marshal(m)
+	if err != nil {
+		return b, err
+	}
+	err = yaml.Unmarshal(d, &b)
+	return b, err
+}
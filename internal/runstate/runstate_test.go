@@ -0,0 +1,121 @@
+package runstate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+	"github.com/koh-sh/codebuild-multirunner/internal/types"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "runs")
+	r, err := New(dir, []string{"config.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !regexp.MustCompile(`^\d{8}-\d{6}-[0-9a-f]{6}$`).MatchString(r.ID) {
+		t.Errorf("New() id = %s", r.ID)
+	}
+	tasks := []*cb.Task{
+		{
+			Group:    "group1",
+			Build:    types.Build{ProjectName: "proj-a", SourceVersion: "main", RunnerOptions: types.RunnerOptions{ID: "a"}},
+			BuildID:  "proj-a:2",
+			Status:   "SUCCEEDED",
+			Attempts: []cb.Attempt{{BuildID: "proj-a:1", Status: "FAILED"}},
+		},
+		{
+			Group:  "group1",
+			Build:  types.Build{ProjectName: "proj-b", RunnerOptions: types.RunnerOptions{DependsOn: []string{"a"}}},
+			Status: cb.StatusFailedToStart,
+			Err:    errors.New("failed to start build for proj-b"),
+		},
+	}
+	r.Update(tasks[:1])
+	r.Update(tasks)
+
+	got, err := Load(dir, r.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ID != r.ID || !reflect.DeepEqual(got.ConfigFiles, []string{"config.yaml"}) || len(got.Builds) != 2 {
+		t.Fatalf("Load() = %+v", got)
+	}
+	want := Build{
+		Group:    "group1",
+		Name:     "a",
+		Entry:    map[string]any{"projectName": "proj-a", "sourceVersion": "main", "id": "a"},
+		BuildID:  "proj-a:2",
+		Status:   "SUCCEEDED",
+		Attempts: []Attempt{{BuildID: "proj-a:1", Status: "FAILED"}},
+	}
+	if !reflect.DeepEqual(got.Builds[0], want) {
+		t.Errorf("Load() build = %+v, want %+v", got.Builds[0], want)
+	}
+	if got.Builds[1].Error != "failed to start build for proj-b" {
+		t.Errorf("Load() error = %s", got.Builds[1].Error)
+	}
+
+	loaded, err := got.Tasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, task := range loaded {
+		if task.Group != tasks[i].Group || !reflect.DeepEqual(task.Build, tasks[i].Build) ||
+			task.BuildID != tasks[i].BuildID || task.Status != tasks[i].Status || !reflect.DeepEqual(task.Attempts, tasks[i].Attempts) {
+			t.Errorf("Tasks()[%d] = %+v, want %+v", i, task, tasks[i])
+		}
+	}
+
+	// no temporary file is left
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != r.ID+".json" {
+		t.Errorf("files in state dir = %v", entries)
+	}
+}
+
+func TestLoadNotFound(t *testing.T) {
+	if _, err := Load(t.TempDir(), "missing"); err == nil {
+		t.Error("Load() error = nil, want error")
+	}
+}
+
+func TestRerunTasks(t *testing.T) {
+	tasks := []*cb.Task{
+		{Group: "g1", Build: types.Build{ProjectName: "a", RunnerOptions: types.RunnerOptions{ID: "a"}}, BuildID: "a:1", Status: "SUCCEEDED"},
+		{Group: "g1", Build: types.Build{ProjectName: "b", RunnerOptions: types.RunnerOptions{ID: "b"}}, BuildID: "b:1", Status: "FAILED"},
+		{Group: "g2", Build: types.Build{ProjectName: "c", RunnerOptions: types.RunnerOptions{DependsOn: []string{"a", "b"}}}, Status: cb.StatusSkipped},
+		{Group: "g2", Build: types.Build{ProjectName: "d"}, BuildID: "d:1", Status: "IN_PROGRESS"},
+	}
+	got := RerunTasks(tasks)
+	if len(got) != 2 {
+		t.Fatalf("RerunTasks() returned %d tasks, want 2", len(got))
+	}
+	if got[0].Name() != "b" || got[0].Status != cb.StatusPending || got[0].BuildID != "" {
+		t.Errorf("RerunTasks()[0] = %+v", got[0])
+	}
+	// dependency on the succeeded build is removed
+	if got[1].Name() != "c" || !reflect.DeepEqual(got[1].Build.DependsOn, []string{"b"}) {
+		t.Errorf("RerunTasks()[1] = %+v", got[1])
+	}
+	// original tasks are not changed
+	if !reflect.DeepEqual(tasks[2].Build.DependsOn, []string{"a", "b"}) {
+		t.Errorf("original dependsOn = %v", tasks[2].Build.DependsOn)
+	}
+
+	groups := Groups(got)
+	if len(groups) != 2 || groups[0].Name != "g1" || groups[1].Name != "g2" || len(groups[1].Builds) != 1 {
+		t.Errorf("Groups() = %+v", groups)
+	}
+	if _, err := cb.NewTasks(groups); err != nil {
+		t.Errorf("NewTasks() error = %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package s3log
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild"
+	cbtypes "github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/koh-sh/codebuild-multirunner/internal/cb"
+)
+
+// ErrS3LogsDisabled is returned if S3 logs are not enabled for a build
+var ErrS3LogsDisabled = errors.New("S3 Logs is Disabled")
+
+// interface for AWS S3 API
+type S3GetObjectAPI interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// return S3 api client
+func NewS3API() (S3GetObjectAPI, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(cfg), nil
+}
+
+// get S3 log location from a build and return bucket, key and error
+func GetS3LogLocation(client cb.CodeBuildAPI, id string) (string, string, error) {
+	input := codebuild.BatchGetBuildsInput{Ids: []string{id}}
+	result, err := client.BatchGetBuilds(context.Background(), &input)
+	if err != nil {
+		return "", "", err
+	}
+	if len(result.Builds) == 0 {
+		return "", "", fmt.Errorf("%v is not found", id)
+	}
+	return S3LogLocation(id, result.Builds[0])
+}
+
+// return bucket and key of the S3 log object of a build
+func S3LogLocation(id string, build cbtypes.Build) (string, string, error) {
+	logs := build.Logs
+	if logs == nil {
+		return "", "", fmt.Errorf("%w for %v", ErrS3LogsDisabled, id)
+	}
+	enabled := logs.S3Logs != nil && logs.S3Logs.Status == cbtypes.LogsConfigStatusTypeEnabled
+	if !enabled && logs.S3DeepLink == nil {
+		return "", "", fmt.Errorf("%w for %v", ErrS3LogsDisabled, id)
+	}
+	// S3LogsArn is like arn:aws:s3:::bucket/prefix/uuid.gz
+	if logs.S3LogsArn != nil {
+		if _, path, ok := strings.Cut(*logs.S3LogsArn, ":::"); ok {
+			if bucket, key, ok := strings.Cut(path, "/"); ok {
+				return bucket, key, nil
+			}
+		}
+	}
+	// S3DeepLink is like https://s3.console.aws.amazon.com/s3/object/bucket/prefix/uuid.gz?region=us-east-1
+	if logs.S3DeepLink != nil {
+		if u, err := url.Parse(*logs.S3DeepLink); err == nil {
+			if _, path, ok := strings.Cut(u.Path, "/s3/object/"); ok {
+				if bucket, key, ok := strings.Cut(path, "/"); ok {
+					return bucket, key, nil
+				}
+			}
+		}
+	}
+	// log object is named after uuid of the build id under the location
+	if logs.S3Logs != nil && logs.S3Logs.Location != nil {
+		_, uuid, _ := strings.Cut(id, ":")
+		if bucket, prefix, ok := strings.Cut(*logs.S3Logs.Location, "/"); ok {
+			return bucket, prefix + "/" + uuid + ".gz", nil
+		}
+		return *logs.S3Logs.Location, uuid + ".gz", nil
+	}
+	return "", "", fmt.Errorf("S3 log location for %v is not found", id)
+}
+
+// print a log object in S3, decompressing it if it is gzipped
+func PrintS3Log(client S3GetObjectAPI, bucket string, key string, out io.Writer) error {
+	result, err := client.GetObject(context.Background(), &s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return err
+	}
+	defer result.Body.Close()
+	body := bufio.NewReader(result.Body)
+	// gzip files start with magic bytes 0x1f 0x8b
+	magic, err := body.Peek(2)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		_, err = io.Copy(out, body)
+		return err
+	}
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	_, err = io.Copy(out, gz)
+	return err
+}
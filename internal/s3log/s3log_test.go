@@ -0,0 +1,134 @@
+package s3log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/codebuild/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type MockS3GetObjectAPI struct {
+	GetObjectMock func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+func (m *MockS3GetObjectAPI) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return m.GetObjectMock(ctx, params, optFns...)
+}
+
+func NewMockS3GetObjectAPI(getObjectMock func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)) *MockS3GetObjectAPI {
+	return &MockS3GetObjectAPI{
+		GetObjectMock: getObjectMock,
+	}
+}
+
+func TestS3LogLocation(t *testing.T) {
+	tests := []struct {
+		name       string
+		logs       *types.LogsLocation
+		wantBucket string
+		wantKey    string
+		wantErr    error
+	}{
+		{
+			name: "from S3LogsArn",
+			logs: &types.LogsLocation{
+				S3Logs:    &types.S3LogsConfig{Status: types.LogsConfigStatusTypeEnabled, Location: aws.String("bucket/logs")},
+				S3LogsArn: aws.String("arn:aws:s3:::bucket/logs/12345678.gz"),
+			},
+			wantBucket: "bucket",
+			wantKey:    "logs/12345678.gz",
+		},
+		{
+			name: "from S3DeepLink",
+			logs: &types.LogsLocation{
+				S3DeepLink: aws.String("https://s3.console.aws.amazon.com/s3/object/bucket/logs/12345678.gz?region=ap-northeast-1"),
+			},
+			wantBucket: "bucket",
+			wantKey:    "logs/12345678.gz",
+		},
+		{
+			name: "from S3Logs location",
+			logs: &types.LogsLocation{
+				S3Logs: &types.S3LogsConfig{Status: types.LogsConfigStatusTypeEnabled, Location: aws.String("bucket/logs")},
+			},
+			wantBucket: "bucket",
+			wantKey:    "logs/12345678.gz",
+		},
+		{
+			name: "S3 Logs disabled",
+			logs: &types.LogsLocation{
+				CloudWatchLogs: &types.CloudWatchLogsConfig{Status: types.LogsConfigStatusTypeEnabled},
+				S3Logs:         &types.S3LogsConfig{Status: types.LogsConfigStatusTypeDisabled},
+			},
+			wantErr: ErrS3LogsDisabled,
+		},
+		{
+			name:    "no logs",
+			wantErr: ErrS3LogsDisabled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket, key, err := S3LogLocation("project:12345678", types.Build{Logs: tt.logs})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("S3LogLocation() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if bucket != tt.wantBucket || key != tt.wantKey {
+				t.Errorf("S3LogLocation() = %v, %v, want %v, %v", bucket, key, tt.wantBucket, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestPrintS3Log(t *testing.T) {
+	var gzipped bytes.Buffer
+	gz := gzip.NewWriter(&gzipped)
+	gz.Write([]byte("first line\nsecond line\n"))
+	gz.Close()
+	client := NewMockS3GetObjectAPI(
+		func(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+			var body []byte
+			switch *params.Key {
+			case "gzipped.gz":
+				body = gzipped.Bytes()
+			case "plain.txt":
+				body = []byte("plain line\n")
+			case "empty.txt":
+			default:
+				return nil, errors.New("NoSuchKey")
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(body))}, nil
+		},
+	)
+	tests := []struct {
+		name    string
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{name: "gzipped log", key: "gzipped.gz", want: "first line\nsecond line\n"},
+		{name: "plain log", key: "plain.txt", want: "plain line\n"},
+		{name: "empty log", key: "empty.txt", want: ""},
+		{name: "API error", key: "missing.gz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			err := PrintS3Log(client, "bucket", tt.key, &out)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PrintS3Log() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if out.String() != tt.want {
+				t.Errorf("PrintS3Log() = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
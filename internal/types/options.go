@@ -0,0 +1,20 @@
+//
+// options for codebuild-multirunner itself. these are not a part of StartBuildInput
+//
+
+package types
+
+// options of a build entry which are handled by codebuild-multirunner.
+// embedded into Build by .github/scripts/update_types_go.sh
+type RunnerOptions struct {
+	ID        string   `yaml:"id,omitempty"`
+	DependsOn []string `yaml:"dependsOn,omitempty"`
+	Retries   int      `yaml:"retries,omitempty"`
+	// start a batch build with StartBuildBatch instead of StartBuild
+	Batch bool `yaml:"batch,omitempty"`
+}
+
+// options of a build group in the map format config
+type GroupOptions struct {
+	MaxParallel int `yaml:"maxParallel,omitempty"`
+}
@@ -14,6 +14,7 @@ type BuildConfig struct {
 }
 
 type Build struct {
+	RunnerOptions                    `yaml:",inline"`
 	ProjectName                      string                            `yaml:"projectName"`
 	SecondarySourcesOverride         []SecondarySourcesOverride        `yaml:"secondarySourcesOverride,omitempty"`
 	SecondarySourcesVersionOverride  []SecondarySourcesVersionOverride `yaml:"secondarySourcesVersionOverride,omitempty"`